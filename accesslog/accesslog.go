@@ -0,0 +1,329 @@
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mix3/phantasma/options"
+)
+
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Subdomain  string    `json:"subdomain"`
+	PodUuid    string    `json:"pod_uuid"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Latency    float64   `json:"latency"`
+	Upstream   string    `json:"upstream"`
+	Referer    string    `json:"referer"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// Unknown is the subdomain of proxied requests whose host is no environment.
+// Subdomains cannot contain "_", so it is never a real one.
+const Unknown = "_unknown"
+
+type entryKey struct{}
+
+func fromRequest(r *http.Request) *Entry {
+	e, _ := r.Context().Value(entryKey{}).(*Entry)
+	return e
+}
+
+func SetSubdomain(r *http.Request, subdomain string) {
+	if e := fromRequest(r); e != nil {
+		e.Subdomain = subdomain
+	}
+}
+
+func SetUpstream(r *http.Request, podUuid, upstream string) {
+	if e := fromRequest(r); e != nil {
+		e.PodUuid = podUuid
+		e.Upstream = upstream
+	}
+}
+
+type Logger struct {
+	mu     sync.Mutex
+	format string
+	out    io.Writer
+	dir    string
+	files  map[string]*os.File
+	recent map[string]*ring
+	size   int
+	hooks  []func(Entry)
+}
+
+func New(opts options.Options) (*Logger, error) {
+	if opts.AccessLogFormat != "json" && opts.AccessLogFormat != "combined" {
+		return nil, fmt.Errorf("unknown access log format: %s", opts.AccessLogFormat)
+	}
+
+	l := &Logger{
+		format: opts.AccessLogFormat,
+		dir:    opts.AccessLogDir,
+		files:  make(map[string]*os.File),
+		recent: make(map[string]*ring),
+		size:   opts.AccessLogRecent,
+	}
+
+	switch opts.AccessLog {
+	case "":
+	case "-":
+		l.out = os.Stdout
+	default:
+		f, err := os.OpenFile(opts.AccessLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		l.out = f
+	}
+
+	if l.dir != "" {
+		if err := os.MkdirAll(l.dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+func (l *Logger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		e := &Entry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Host:       r.Host,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+		rw := &responseWriter{ResponseWriter: w}
+
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), entryKey{}, e)))
+
+		e.Status = rw.status
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Bytes = rw.bytes
+		e.Latency = time.Since(start).Seconds()
+
+		l.write(e)
+
+		for _, hook := range l.hooks {
+			hook(*e)
+		}
+	})
+}
+
+func (l *Logger) AddHook(hook func(Entry)) {
+	l.hooks = append(l.hooks, hook)
+}
+
+func (l *Logger) write(e *Entry) {
+	line, err := l.formatEntry(e)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.out != nil {
+		l.out.Write(line)
+	}
+
+	// Files and recent entries are kept only for environments, so that
+	// random hosts cannot create them.
+	if e.Subdomain == "" || e.Subdomain == Unknown {
+		return
+	}
+
+	if l.dir != "" {
+		f, err := l.file(e.Subdomain)
+		if err == nil {
+			f.Write(line)
+		}
+	}
+
+	if 0 < l.size {
+		rb, ok := l.recent[e.Subdomain]
+		if !ok {
+			rb = newRing(l.size)
+			l.recent[e.Subdomain] = rb
+		}
+		rb.add(*e)
+	}
+}
+
+func (l *Logger) file(subdomain string) (*os.File, error) {
+	if f, ok := l.files[subdomain]; ok {
+		return f, nil
+	}
+
+	f, err := os.OpenFile(
+		filepath.Join(l.dir, filepath.Base(subdomain)+".log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.files[subdomain] = f
+
+	return f, nil
+}
+
+func (l *Logger) formatEntry(e *Entry) ([]byte, error) {
+	if l.format == "json" {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+
+	return []byte(fmt.Sprintf(
+		"%s - - [%s] %q %d %d %q %q %s %s %s %.6f\n",
+		host,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		fmt.Sprintf("%s %s %s", e.Method, e.Path, e.Proto),
+		e.Status,
+		e.Bytes,
+		e.Referer,
+		e.UserAgent,
+		dash(e.Subdomain),
+		dash(e.PodUuid),
+		dash(e.Upstream),
+		e.Latency,
+	)), nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func (l *Logger) Recent(subdomain string, limit int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rb, ok := l.recent[subdomain]
+	if !ok {
+		return []Entry{}
+	}
+
+	return rb.list(limit)
+}
+
+func (l *Logger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.out.(io.Closer); ok && l.out != os.Stdout {
+		c.Close()
+	}
+	for k, f := range l.files {
+		f.Close()
+		delete(l.files, k)
+	}
+}
+
+type ring struct {
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func newRing(size int) *ring {
+	return &ring{entries: make([]Entry, size)}
+}
+
+func (rb *ring) add(e Entry) {
+	rb.entries[rb.next] = e
+	rb.next = (rb.next + 1) % len(rb.entries)
+	if rb.next == 0 {
+		rb.full = true
+	}
+}
+
+// list returns entries newest first.
+func (rb *ring) list(limit int) []Entry {
+	n := rb.next
+	if rb.full {
+		n = len(rb.entries)
+	}
+	if 0 < limit && limit < n {
+		n = limit
+	}
+
+	result := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, rb.entries[(rb.next-i+len(rb.entries))%len(rb.entries)])
+	}
+	return result
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
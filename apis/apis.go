@@ -1,33 +1,67 @@
 package apis
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
 	"github.com/coreos/go-systemd/dbus"
 	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/httpcache"
+	"github.com/mix3/phantasma/jobs"
+	"github.com/mix3/phantasma/metrics"
 	"github.com/mix3/phantasma/options"
 	"github.com/mix3/phantasma/rkt/api/v1alpha"
-	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 )
 
 type Api struct {
 	apiEndpoint string
 	grpcConn    *grpc.ClientConn
 	apiClient   v1alpha.PublicAPIClient
+	dbusMu      sync.Mutex
 	dbusConn    *dbus.Conn
+	pods        podCache
 	opts        options.Options
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 func New(opts options.Options) (*Api, error) {
-	grpcConn, err := grpc.Dial(opts.ApiEndpoint, grpc.WithInsecure())
+	maxDelay := opts.RktApiMaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = backoff.DefaultConfig.MaxDelay
+	}
+
+	// The connection is made in the background and remade with backoff
+	// whenever the rkt api service goes away.
+	grpcConn, err := grpc.Dial(
+		opts.ApiEndpoint,
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(metrics.UnaryClientInterceptor),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  time.Second,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   maxDelay,
+			},
+			MinConnectTimeout: 5 * time.Second,
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("did not connect: grpc %v", err)
 	}
@@ -35,35 +69,71 @@ func New(opts options.Options) (*Api, error) {
 	if err != nil {
 		return nil, fmt.Errorf("did not connect: dbus %v", err)
 	}
-	return &Api{
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api := &Api{
 		apiEndpoint: opts.ApiEndpoint,
 		grpcConn:    grpcConn,
 		apiClient:   v1alpha.NewPublicAPIClient(grpcConn),
 		dbusConn:    dbusConn,
 		opts:        opts,
-	}, nil
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	go api.watchRkt()
+	go api.watchDbus()
+
+	return api, nil
 }
 
 func (api *Api) Close() {
+	api.cancel()
 	api.grpcConn.Close()
-	api.dbusConn.Close()
+	api.systemd().Close()
+}
+
+var (
+	ErrImageNotFound   = errors.New("image not found")
+	ErrImageDuplicated = errors.New("image found, but duplicated")
+	ErrTimeout         = errors.New("timed out")
+)
+
+// rpcContext bounds a rkt api call by --rkt-api-timeout.
+func (api *Api) rpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if api.opts.RktApiTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, api.opts.RktApiTimeout)
 }
 
-func (api *Api) getImageById(id string) (*v1alpha.Image, error) {
+// callError describes a failed call, wrapping ErrTimeout when ctx ran out so
+// that it can be told apart from other failures.
+func callError(ctx context.Context, call string, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("could not %s: %v: %w", call, err, ErrTimeout)
+	}
+	return fmt.Errorf("could not %s: %v", call, err)
+}
+
+func (api *Api) getImageById(ctx context.Context, id string) (*v1alpha.Image, error) {
+	ctx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
 	res, err := api.apiClient.InspectImage(
-		context.Background(),
+		ctx,
 		&v1alpha.InspectImageRequest{
 			Id: id,
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("could not InspectImageRequest: %v", err)
+		return nil, callError(ctx, "InspectImageRequest", err)
 	}
 
 	image := res.GetImage()
 
 	if image == nil {
-		return nil, fmt.Errorf("image not found: id %v", id)
+		return nil, fmt.Errorf("%w: id %v", ErrImageNotFound, id)
 	}
 
 	return image, nil
@@ -87,7 +157,7 @@ func (api *Api) splitImageName(imageName string) (string, string, string, error)
 	return prefix, name, version, nil
 }
 
-func (api *Api) getImageByName(name string) (*v1alpha.Image, error) {
+func (api *Api) getImageByName(ctx context.Context, name string) (*v1alpha.Image, error) {
 	prefix, name, version, err := api.splitImageName(name)
 	if err != nil {
 		return nil, err
@@ -104,25 +174,28 @@ func (api *Api) getImageByName(name string) (*v1alpha.Image, error) {
 		filter.Labels = []*v1alpha.KeyValue{&v1alpha.KeyValue{"version", version}}
 	}
 
+	listCtx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
 	res, err := api.apiClient.ListImages(
-		context.Background(),
+		listCtx,
 		&v1alpha.ListImagesRequest{Filter: filter},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("could not ListImagesRequest: %v", err)
+		return nil, callError(listCtx, "ListImagesRequest", err)
 	}
 
 	images := res.GetImages()
 
 	if images == nil || len(images) == 0 {
-		return nil, fmt.Errorf("image not found: name %v", name)
+		return nil, fmt.Errorf("%w: name %v", ErrImageNotFound, name)
 	}
 
 	if 1 < len(images) {
-		return nil, fmt.Errorf("image found, but duplicated: name %v", name)
+		return nil, fmt.Errorf("%w: name %v", ErrImageDuplicated, name)
 	}
 
-	return api.getImageById(images[0].Id)
+	return api.getImageById(ctx, images[0].Id)
 }
 
 func (api *Api) generatePodManifest(image *v1alpha.Image, annotationMap map[string]string, env forms.Envs) (*schema.PodManifest, error) {
@@ -177,13 +250,52 @@ func (api *Api) unitPath(subdomain string) string {
 	return fmt.Sprintf("%s/%s", api.opts.ServiceDir, api.withPrefix(subdomain))
 }
 
-func (api *Api) createUnit(podManifest *schema.PodManifest, subdomain string) error {
+// unitName names the unit of a replica <subdomain>_<replica>, the unit of a
+// single pod being <subdomain>. With "-" as the separator, replica 1 of "foo"
+// would share the unit of the subdomain "foo-1"; subdomains cannot contain
+// "_".
+func (api *Api) unitName(subdomain string, replica, replicas int) string {
+	if replicas <= 1 {
+		return subdomain
+	}
+	return fmt.Sprintf("%s_%d", subdomain, replica)
+}
+
+// subdomainUnits returns the unit files of subdomain.
+func (api *Api) subdomainUnits(subdomain string) ([]string, error) {
+	paths, err := filepath.Glob(api.unitPath(subdomain + ".service"))
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := filepath.Glob(api.unitPath(subdomain + "_*.service"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, path := range append(paths, replicas...) {
+		result = append(result, filepath.Base(path))
+	}
+	return result, nil
+}
+
+// removeUnit removes the file of a stopped unit and the pod manifest it wrote.
+func (api *Api) removeUnit(unit string) error {
+	os.Remove(api.tmpPath(strings.TrimSuffix(unit, ".service") + ".manifest"))
+
+	if err := os.Remove(filepath.Join(api.opts.ServiceDir, unit)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (api *Api) createUnit(podManifest *schema.PodManifest, name string) error {
 	podManifestJSON, err := podManifest.MarshalJSON()
 	if err != nil {
 		return err
 	}
 
-	serviceName := api.withPrefix(subdomain)
+	serviceName := api.withPrefix(name)
 	unit := []byte(fmt.Sprintf(`
 [Unit]
 Description=%s
@@ -211,7 +323,7 @@ KillMode=mixed
 		return err
 	}
 
-	if err := os.Rename(tmpFile.Name(), api.unitPath(subdomain+".service")); err != nil {
+	if err := os.Rename(tmpFile.Name(), api.unitPath(name+".service")); err != nil {
 		os.Remove(tmpFile.Name())
 		return err
 	}
@@ -219,73 +331,237 @@ KillMode=mixed
 	return nil
 }
 
-func (api *Api) runByImage(image *v1alpha.Image, subdomain, port, net string, env forms.Envs) error {
-	podManifest, err := api.generatePodManifest(image, map[string]string{
-		api.opts.Specific + "-is":        "1",
-		api.opts.Specific + "-subdomain": subdomain,
-		api.opts.Specific + "-port":      port,
-		api.opts.Specific + "-net":       net,
-	}, env)
+func (api *Api) imagePort(image *v1alpha.Image) (int, error) {
+	imageManifest := schema.BlankImageManifest()
+	if err := imageManifest.UnmarshalJSON(image.Manifest); err != nil {
+		return 0, err
+	}
+
+	if imageManifest.App == nil || len(imageManifest.App.Ports) == 0 {
+		return api.opts.DefaultPort, nil
+	}
+
+	return int(imageManifest.App.Ports[0].Port), nil
+}
+
+func (api *Api) runByImage(ctx context.Context, image *v1alpha.Image, lf *forms.LaunchForm, progress func(string)) error {
+	defer api.pods.invalidate()
+
+	port := lf.Port
+	if port == 0 {
+		imagePort, err := api.imagePort(image)
+		if err != nil {
+			return err
+		}
+		port = imagePort
+	}
+
+	replicas := lf.Replicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	oldUnits, err := api.subdomainUnits(lf.Subdomain)
 	if err != nil {
 		return err
 	}
 
-	if err := api.createUnit(podManifest, subdomain); err != nil {
-		return err
+	progress(jobs.WritingUnit)
+
+	newUnits := make(map[string]bool)
+	for i := 0; i < replicas; i++ {
+		podManifest, err := api.generatePodManifest(image, map[string]string{
+			api.opts.Specific + "-is":        "1",
+			api.opts.Specific + "-subdomain": lf.Subdomain,
+			api.opts.Specific + "-replica":   strconv.Itoa(i),
+			api.opts.Specific + "-replicas":  strconv.Itoa(replicas),
+			api.opts.Specific + "-lb":        lf.LB,
+			api.opts.Specific + "-port":      strconv.Itoa(port),
+			api.opts.Specific + "-ports":     lf.PortMaps.String(),
+			api.opts.Specific + "-net":       lf.Net,
+			api.opts.Specific + "-aliases":   strings.Join(lf.Aliases, ","),
+			api.opts.Specific + "-tcp":       lf.TCPForwards.String(),
+			api.opts.Specific + "-limits":    lf.Limits.String(),
+		}, lf.Envs)
+		if err != nil {
+			return err
+		}
+
+		name := api.unitName(lf.Subdomain, i, replicas)
+		if err := api.createUnit(podManifest, name); err != nil {
+			return err
+		}
+		newUnits[api.withPrefix(name+".service")] = true
 	}
 
-	if err := api.dbusConn.Reload(); err != nil {
+	progress(jobs.Starting)
+
+	if err := api.reload(ctx); err != nil {
 		return err
 	}
 
-	resCh := make(chan string)
-	if _, err := api.dbusConn.RestartUnit(
-		api.withPrefix(subdomain+".service"),
-		"replace",
-		resCh,
-	); err != nil {
+	var surplus []string
+	for _, unit := range oldUnits {
+		if !newUnits[unit] {
+			surplus = append(surplus, unit)
+		}
+	}
+	if err := api.removeUnits(ctx, surplus); err != nil {
 		return err
 	}
 
-	if job := <-resCh; job != "done" {
-		return fmt.Errorf("job is not done: %s", job)
+	for i := 0; i < replicas; i++ {
+		unit := api.withPrefix(api.unitName(lf.Subdomain, i, replicas) + ".service")
+		err := api.waitJob(ctx, "restart", func(resCh chan<- string) (int, error) {
+			return api.systemd().RestartUnit(unit, "replace", resCh)
+		})
+		if errors.Is(err, ErrTimeout) && ctx.Err() == nil {
+			// systemd goes on with the job, so the pod may still come up.
+			// Whether it does is left to the caller waiting for it to run.
+			log.Printf("[rktapi] restart %v: %v, not waiting for it", unit, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Printf("[rktapi] start %v", subdomain)
+	log.Printf("[rktapi] start %v (replicas %d)", lf.Subdomain, replicas)
 
 	return nil
 }
 
-func (api *Api) RunByImageId(imageId, subdomain, port, net string, env forms.Envs) error {
-	image, err := api.getImageById(imageId)
+// Launch starts the pods of lf, reporting the job states it goes through to
+// progress when it is not nil. A restart outliving --dbus-timeout is not an
+// error, so callers wait for the pods to run.
+func (api *Api) Launch(ctx context.Context, lf *forms.LaunchForm, progress func(string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	var (
+		image *v1alpha.Image
+		err   error
+	)
+	if lf.ImageId != "" {
+		image, err = api.getImageById(ctx, lf.ImageId)
+	} else {
+		image, err = api.getImageByName(ctx, lf.ImageName)
+	}
 	if err != nil {
 		return err
 	}
 
-	return api.runByImage(image, subdomain, port, net, env)
+	return api.runByImage(ctx, image, lf, progress)
 }
 
-func (api *Api) RunByImageName(imageName, subdomain, port, net string, env forms.Envs) error {
-	image, err := api.getImageByName(imageName)
-	if err != nil {
+// dbusContext bounds a systemd job by --dbus-timeout.
+func (api *Api) dbusContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if api.opts.DbusTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, api.opts.DbusTimeout)
+}
+
+// waitJob starts a systemd job and waits for it until ctx is done or
+// --dbus-timeout passes. The job itself is left to systemd when the wait is
+// given up.
+func (api *Api) waitJob(ctx context.Context, operation string, startJob func(chan<- string) (int, error)) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDbusJob(operation, start, err)
+	}()
+
+	ctx, cancel := api.dbusContext(ctx)
+	defer cancel()
+
+	// Buffered, as the result is sent even when nobody waits any more.
+	resCh := make(chan string, 1)
+	if _, err := startJob(resCh); err != nil {
 		return err
 	}
 
-	return api.runByImage(image, subdomain, port, net, env)
+	select {
+	case job := <-resCh:
+		if job != "done" {
+			return fmt.Errorf("job is not done: %s", job)
+		}
+	case <-ctx.Done():
+		return callError(ctx, operation+" job", ctx.Err())
+	}
+
+	return nil
 }
 
-func (api *Api) Stop(subdomain string) error {
-	resCh := make(chan string)
-	if _, err := api.dbusConn.StopUnit(
-		api.withPrefix(subdomain+".service"),
-		"replace",
-		resCh,
-	); err != nil {
+func (api *Api) reload(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDbusJob("reload", start, err)
+	}()
+
+	ctx, cancel := api.dbusContext(ctx)
+	defer cancel()
+
+	return api.dbusCall(ctx, "reload", func(conn *dbus.Conn) error {
+		return conn.Reload()
+	})
+}
+
+// dbusCall runs a blocking dbus call, giving up on it when ctx is done.
+func (api *Api) dbusCall(ctx context.Context, call string, fn func(*dbus.Conn) error) error {
+	conn := api.systemd()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn(conn)
+	}()
+
+	select {
+	case err := <-errCh:
 		return err
+	case <-ctx.Done():
+		return callError(ctx, call, ctx.Err())
 	}
+}
 
-	if job := <-resCh; job != "done" {
-		return fmt.Errorf("job is not done: %s", job)
+func (api *Api) stopUnit(ctx context.Context, unit string) error {
+	return api.waitJob(ctx, "stop", func(resCh chan<- string) (int, error) {
+		return api.systemd().StopUnit(unit, "replace", resCh)
+	})
+}
+
+// removeUnits stops units and removes their files, so that they are not
+// left over when a subdomain has fewer replicas or is terminated.
+func (api *Api) removeUnits(ctx context.Context, units []string) error {
+	if len(units) == 0 {
+		return nil
+	}
+
+	for _, unit := range units {
+		if err := api.stopUnit(ctx, unit); err != nil {
+			return err
+		}
+		if err := api.removeUnit(unit); err != nil {
+			return err
+		}
+	}
+
+	return api.reload(ctx)
+}
+
+func (api *Api) Stop(ctx context.Context, subdomain string) error {
+	defer api.pods.invalidate()
+
+	units, err := api.subdomainUnits(subdomain)
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		units = []string{api.withPrefix(subdomain + ".service")}
+	}
+
+	if err := api.removeUnits(ctx, units); err != nil {
+		return err
 	}
 
 	log.Printf("[rktapi] stop %v", subdomain)
@@ -299,12 +575,15 @@ type ImageInfo struct {
 	Version string `json:"version"`
 }
 
-func (api *Api) ImageList() ([]ImageInfo, error) {
-	res, err := api.apiClient.ListImages(context.Background(), &v1alpha.ListImagesRequest{
+func (api *Api) ImageList(ctx context.Context) ([]ImageInfo, error) {
+	ctx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
+	res, err := api.apiClient.ListImages(ctx, &v1alpha.ListImagesRequest{
 		Filter: &v1alpha.ImageFilter{},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("could not ListImages: %v", err)
+		return nil, callError(ctx, "ListImages", err)
 	}
 	var result []ImageInfo
 	for _, v := range res.GetImages() {
@@ -317,15 +596,100 @@ func (api *Api) ImageList() ([]ImageInfo, error) {
 	return result, nil
 }
 
+func (api *Api) GetImage(ctx context.Context, id string) (ImageInfo, error) {
+	ctx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
+	res, err := api.apiClient.ListImages(ctx, &v1alpha.ListImagesRequest{
+		Filter: &v1alpha.ImageFilter{
+			Ids: []string{id},
+		},
+	})
+	if err != nil {
+		return ImageInfo{}, callError(ctx, "ListImages", err)
+	}
+
+	images := res.GetImages()
+	if len(images) == 0 {
+		return ImageInfo{}, fmt.Errorf("%w: id %v", ErrImageNotFound, id)
+	}
+
+	return ImageInfo{
+		Id:      images[0].Id,
+		Name:    images[0].Name,
+		Version: images[0].Version,
+	}, nil
+}
+
 type PodInfo struct {
-	Uuid      string      `json:"uuid"`
-	Image     string      `json:"image"`
-	Subdomain string      `json:"subdomain"`
-	Port      int         `json:"port"`
-	Net       string      `json:"net"`
-	Host      string      `json:"host"`
-	Running   bool        `json:"running"`
-	Env       []forms.Env `json:"env"`
+	Uuid        string            `json:"uuid"`
+	Image       string            `json:"image"`
+	Subdomain   string            `json:"subdomain"`
+	Port        int               `json:"port"`
+	Net         string            `json:"net"`
+	Host        string            `json:"host"`
+	Running     bool              `json:"running"`
+	Env         []forms.Env       `json:"env"`
+	Aliases     []string          `json:"aliases"`
+	Ports       forms.PortMaps    `json:"ports"`
+	TCPForwards forms.TCPForwards `json:"tcp_forwards"`
+	LB          string            `json:"lb"`
+	Replica     int               `json:"-"`
+	ReplicaSize int               `json:"replica_size"`
+	Replicas    []ReplicaInfo     `json:"replicas"`
+	Variants    forms.Variants    `json:"variants"`
+	Mirror      *forms.Mirror     `json:"mirror"`
+	Compress    bool              `json:"compress"`
+	Cache       *httpcache.Stats  `json:"cache"`
+	Limits      forms.Limits      `json:"limits"`
+}
+
+// LaunchForm returns the form that launches info again with the same image
+// and settings.
+func (info PodInfo) LaunchForm() *forms.LaunchForm {
+	return &forms.LaunchForm{
+		ImageName:   info.Image,
+		Subdomain:   info.Subdomain,
+		Port:        info.Port,
+		Net:         info.Net,
+		Envs:        info.Env,
+		Aliases:     info.Aliases,
+		PortMaps:    info.Ports,
+		TCPForwards: info.TCPForwards,
+		Replicas:    info.ReplicaSize,
+		LB:          info.LB,
+		Limits:      info.Limits,
+	}
+}
+
+type ReplicaInfo struct {
+	Replica int    `json:"replica"`
+	Uuid    string `json:"uuid"`
+	Host    string `json:"host"`
+}
+
+type byReplica []ReplicaInfo
+
+func (r byReplica) Len() int           { return len(r) }
+func (r byReplica) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byReplica) Less(i, j int) bool { return r[i].Replica < r[j].Replica }
+
+// mergeReplica folds the replica pod b into a, keeping the lowest replica as
+// the representative pod of the subdomain.
+func mergeReplica(a, b PodInfo) PodInfo {
+	if a.Uuid == "" {
+		return b
+	}
+
+	replicas := append(a.Replicas, b.Replicas...)
+	sort.Sort(byReplica(replicas))
+
+	if b.Replica < a.Replica {
+		a = b
+	}
+	a.Replicas = replicas
+
+	return a
 }
 
 func (api *Api) podToPodInfo(pod *v1alpha.Pod) PodInfo {
@@ -339,8 +703,13 @@ func (api *Api) podToPodInfo(pod *v1alpha.Pod) PodInfo {
 			pod.Apps[0].Image.Name,
 			pod.Apps[0].Image.Version,
 		),
-		Running: true,
-		Env:     []forms.Env{},
+		Running:     true,
+		Env:         []forms.Env{},
+		Aliases:     []string{},
+		Ports:       forms.PortMaps{},
+		TCPForwards: forms.TCPForwards{},
+		ReplicaSize: 1,
+		Variants:    forms.Variants{},
 	}
 
 	for _, v := range podManifest.Annotations {
@@ -353,12 +722,40 @@ func (api *Api) podToPodInfo(pod *v1alpha.Pod) PodInfo {
 		if v.Name.String() == api.opts.Specific+"-net" {
 			info.Net = v.Value
 		}
+		if v.Name.String() == api.opts.Specific+"-aliases" && v.Value != "" {
+			info.Aliases = strings.Split(v.Value, ",")
+		}
+		if v.Name.String() == api.opts.Specific+"-ports" && v.Value != "" {
+			info.Ports.Bind("ports", strings.Split(v.Value, ","), nil)
+		}
+		if v.Name.String() == api.opts.Specific+"-tcp" && v.Value != "" {
+			info.TCPForwards.Bind("tcp", strings.Split(v.Value, ","), nil)
+		}
+		if v.Name.String() == api.opts.Specific+"-limits" {
+			info.Limits = forms.ParseLimits(v.Value)
+		}
+		if v.Name.String() == api.opts.Specific+"-lb" {
+			info.LB = v.Value
+		}
+		if v.Name.String() == api.opts.Specific+"-replica" {
+			info.Replica, _ = strconv.Atoi(v.Value)
+		}
+		if v.Name.String() == api.opts.Specific+"-replicas" {
+			info.ReplicaSize, _ = strconv.Atoi(v.Value)
+		}
 	}
 	for _, v := range pod.Networks {
 		if v.Name == info.Net {
 			info.Host = v.Ipv4
 		}
 	}
+	info.Replicas = []ReplicaInfo{
+		{
+			Replica: info.Replica,
+			Uuid:    info.Uuid,
+			Host:    info.Host,
+		},
+	}
 	for _, v := range podManifest.Apps[0].App.Environment {
 		info.Env = append(info.Env, forms.Env{
 			Key: v.Name,
@@ -369,56 +766,58 @@ func (api *Api) podToPodInfo(pod *v1alpha.Pod) PodInfo {
 	return info
 }
 
-func (api *Api) PodInfoMap() (map[string]PodInfo, error) {
-	res, err := api.apiClient.ListPods(
-		context.Background(),
-		&v1alpha.ListPodsRequest{
-			Filter: &v1alpha.PodFilter{
-				States: []v1alpha.PodState{v1alpha.PodState_POD_STATE_RUNNING},
-				Annotations: []*v1alpha.KeyValue{
-					{
-						Key:   api.opts.Specific + "-is",
-						Value: "1",
-					},
-				},
-			},
-		},
-	)
+// PodInfoMap returns the running environments by subdomain from the pod
+// cache, refreshing it when it is older than --pod-cache-ttl.
+func (api *Api) PodInfoMap(ctx context.Context) (map[string]PodInfo, error) {
+	view, err := api.podView(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("could not ListPodsRequest: %v", err)
+		return nil, err
 	}
 
-	result := make(map[string]PodInfo)
-	for _, pod := range res.GetPods() {
-		res, err := api.apiClient.InspectPod(
-			context.Background(),
-			&v1alpha.InspectPodRequest{
-				Id: pod.Id,
-			},
-		)
-		if err != nil {
-			return nil, fmt.Errorf("could not InspectPodRequest: %v", err)
-		}
-
-		inspectPod := res.GetPod()
-		if inspectPod == nil {
-			continue
-		}
+	result := make(map[string]PodInfo, len(view))
+	for k, v := range view {
+		result[k] = v
+	}
+	return result, nil
+}
 
-		info := api.podToPodInfo(inspectPod)
+func (api *Api) GetPodInfo(ctx context.Context, subdomain string) (PodInfo, error) {
+	view, err := api.podView(ctx)
+	if err != nil {
+		return PodInfo{}, err
+	}
 
-		result[info.Subdomain] = info
+	if info, ok := view[subdomain]; ok {
+		return info, nil
 	}
 
-	return result, nil
+	return PodInfo{
+		Subdomain:   subdomain,
+		Running:     false,
+		Aliases:     []string{},
+		Ports:       forms.PortMaps{},
+		TCPForwards: forms.TCPForwards{},
+		Replicas:    []ReplicaInfo{},
+		Variants:    forms.Variants{},
+	}, nil
 }
 
-func (api *Api) GetPodInfo(subdomain string) (PodInfo, error) {
+// Starting reports whether a pod of subdomain is being prepared but is not
+// running yet. Once the pods found starting by an earlier call are done, the
+// pod cache is dropped, so that they are seen running before --pod-cache-ttl.
+func (api *Api) Starting(ctx context.Context, subdomain string) (bool, error) {
+	ctx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
 	res, err := api.apiClient.ListPods(
-		context.Background(),
+		ctx,
 		&v1alpha.ListPodsRequest{
 			Filter: &v1alpha.PodFilter{
-				States: []v1alpha.PodState{v1alpha.PodState_POD_STATE_RUNNING},
+				States: []v1alpha.PodState{
+					v1alpha.PodState_POD_STATE_EMBRYO,
+					v1alpha.PodState_POD_STATE_PREPARING,
+					v1alpha.PodState_POD_STATE_PREPARED,
+				},
 				Annotations: []*v1alpha.KeyValue{
 					{
 						Key:   api.opts.Specific + "-subdomain",
@@ -429,32 +828,39 @@ func (api *Api) GetPodInfo(subdomain string) (PodInfo, error) {
 		},
 	)
 	if err != nil {
-		return PodInfo{}, fmt.Errorf("could not ListPodsRequest: %v", err)
+		return false, callError(ctx, "ListPodsRequest", err)
 	}
 
-	for _, pod := range res.GetPods() {
-		res, err := api.apiClient.InspectPod(
-			context.Background(),
-			&v1alpha.InspectPodRequest{
-				Id: pod.Id,
-			},
-		)
+	starting := 0 < len(res.GetPods())
+	api.pods.setStarting(subdomain, starting)
+	return starting, nil
+}
+
+// Logs passes the journal lines of pod uuid to fn. With follow it keeps
+// streaming until ctx is done.
+func (api *Api) Logs(ctx context.Context, uuid string, lines int, follow bool, fn func(string) error) error {
+	stream, err := api.apiClient.GetLogs(ctx, &v1alpha.GetLogsRequest{
+		PodId:  uuid,
+		Lines:  int32(lines),
+		Follow: follow,
+	})
+	if err != nil {
+		return fmt.Errorf("could not GetLogs: %v", err)
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
 		if err != nil {
-			return PodInfo{}, fmt.Errorf("could not InspectPodRequest: %v", err)
+			return fmt.Errorf("could not GetLogs: %v", err)
 		}
 
-		inspectPod := res.GetPod()
-		if inspectPod == nil {
-			continue
+		for _, v := range res.Lines {
+			if err := fn(v); err != nil {
+				return err
+			}
 		}
-
-		info := api.podToPodInfo(inspectPod)
-
-		return info, nil
 	}
-
-	return PodInfo{
-		Subdomain: subdomain,
-		Running:   false,
-	}, nil
 }
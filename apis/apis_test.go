@@ -0,0 +1,71 @@
+package apis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mix3/phantasma/options"
+)
+
+func TestSubdomainUnits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "units")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"phantasma-foo_0.service",
+		"phantasma-foo_1.service",
+		"phantasma-foo-0.service",
+		"phantasma-foobar.service",
+		"phantasma-foo.bar.service",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("[Unit]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api := &Api{opts: options.Options{Specific: "phantasma", ServiceDir: dir, TmpDir: dir}}
+
+	tests := []struct {
+		subdomain string
+		want      []string
+	}{
+		{"foo", []string{"phantasma-foo_0.service", "phantasma-foo_1.service"}},
+		{"foo-0", []string{"phantasma-foo-0.service"}},
+		{"foobar", []string{"phantasma-foobar.service"}},
+		{"baz", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := api.subdomainUnits(tt.subdomain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: units %v, want %v", tt.subdomain, got, tt.want)
+		}
+	}
+
+	if got := api.unitName("foo", 0, 2); got != "foo_0" {
+		t.Errorf("unit name %q", got)
+	}
+	if got := api.unitName("foo", 0, 1); got != "foo" {
+		t.Errorf("unit name %q", got)
+	}
+
+	if err := api.removeUnit("phantasma-foo_1.service"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.removeUnit("phantasma-foo_1.service"); err != nil {
+		t.Errorf("removing a removed unit: %v", err)
+	}
+	if got, _ := api.subdomainUnits("foo"); len(got) != 1 || got[0] != "phantasma-foo_0.service" {
+		t.Errorf("units %v after remove", got)
+	}
+}
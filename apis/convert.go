@@ -0,0 +1,55 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Convert turns the docker archive at path, as written by docker save, into
+// an ACI with docker2aci. The ACI is made in a directory under --tmp-dir that
+// remove deletes. The output of docker2aci is copied to out as it comes.
+func (api *Api) Convert(ctx context.Context, path string, out io.Writer) (aci string, remove func(), err error) {
+	dir, err := ioutil.TempDir(api.opts.TmpDir, api.opts.Specific+"-docker2aci-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	// docker2aci writes the ACI into the working directory.
+	cmd := exec.CommandContext(ctx, api.opts.Docker2aci, path)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = fetchWaitDelay
+
+	log.Printf("[rktapi] convert %v", path)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", nil, fmt.Errorf("could not convert %s: %v: %w", path, err, ErrTimeout)
+		}
+		return "", nil, fmt.Errorf("could not convert %s: %v", path, err)
+	}
+
+	acis, err := filepath.Glob(filepath.Join(dir, "*.aci"))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(acis) != 1 {
+		return "", nil, fmt.Errorf("could not convert %s: docker2aci made %d ACIs, expected 1", path, len(acis))
+	}
+
+	log.Printf("[rktapi] converted %v to %v", path, acis[0])
+
+	return acis[0], func() { os.RemoveAll(dir) }, nil
+}
@@ -0,0 +1,81 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mix3/phantasma/options"
+)
+
+// fakeDocker2aci writes a shell script standing in for docker2aci and returns
+// an Api that runs it.
+func fakeDocker2aci(t *testing.T, script string) *Api {
+	dir, err := ioutil.TempDir("", "docker2aci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "docker2aci")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Api{opts: options.Options{Docker2aci: path, TmpDir: dir, Specific: "phantasma"}}
+}
+
+func TestConvert(t *testing.T) {
+	api := fakeDocker2aci(t, `
+echo "converting $1"
+echo aci > app-latest.aci
+`)
+
+	var out bytes.Buffer
+	aci, remove, err := api.Convert(context.Background(), "/tmp/upload", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(aci) != "app-latest.aci" {
+		t.Errorf("aci %s", aci)
+	}
+	if got := out.String(); got != "converting /tmp/upload\n" {
+		t.Errorf("output %q", got)
+	}
+
+	remove()
+	if _, err := os.Stat(filepath.Dir(aci)); !os.IsNotExist(err) {
+		t.Errorf("dir of %s not removed: %v", aci, err)
+	}
+}
+
+func TestConvertFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"exit status", "exit 1\n", "exit status 1"},
+		{"no aci", "true\n", "made 0 ACIs"},
+		{"two acis", "touch a.aci b.aci\n", "made 2 ACIs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := fakeDocker2aci(t, tt.script)
+
+			_, _, err := api.Convert(context.Background(), "/tmp/upload", ioutil.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want %q", err, tt.want)
+			}
+
+			dirs, _ := filepath.Glob(filepath.Join(api.opts.TmpDir, "phantasma-docker2aci-*"))
+			if len(dirs) != 0 {
+				t.Errorf("dirs %v left over", dirs)
+			}
+		})
+	}
+}
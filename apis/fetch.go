@@ -0,0 +1,55 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const fetchWaitDelay = 5 * time.Second
+
+// Fetch runs rkt fetch for name, an appc image name or URL or a docker://
+// URL, and returns the id of the image in the store. The output of rkt is
+// copied to out as it comes.
+func (api *Api) Fetch(ctx context.Context, name string, out io.Writer) (string, error) {
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(
+		ctx,
+		api.opts.Rkt,
+		"fetch",
+		"--insecure-options="+api.opts.InsecureOptions,
+		"--full",
+		"--",
+		name,
+	)
+	cmd.Stdout = io.MultiWriter(&stdout, out)
+	cmd.Stderr = out
+	// Children of rkt may keep its output open after it was killed.
+	cmd.WaitDelay = fetchWaitDelay
+
+	log.Printf("[rktapi] fetch %v", name)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("could not fetch %s: %v: %w", name, err, ErrTimeout)
+		}
+		return "", fmt.Errorf("could not fetch %s: %v", name, err)
+	}
+
+	// rkt prints the image id as the last line on stdout.
+	lines := strings.Fields(stdout.String())
+	if len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], "sha512-") {
+		return "", fmt.Errorf("could not fetch %s: no image id in the output of rkt", name)
+	}
+	id := lines[len(lines)-1]
+
+	log.Printf("[rktapi] fetched %v as %v", name, id)
+
+	return id, nil
+}
@@ -0,0 +1,118 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mix3/phantasma/jobs"
+	"github.com/mix3/phantasma/options"
+)
+
+// fakeRkt writes a shell script standing in for rkt and returns an Api that
+// runs it.
+func fakeRkt(t *testing.T, script string) *Api {
+	dir, err := ioutil.TempDir("", "rkt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "rkt")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Api{opts: options.Options{Rkt: path, InsecureOptions: "image,tls"}}
+}
+
+func TestFetch(t *testing.T) {
+	api := fakeRkt(t, `
+echo "args: $*" >&2
+echo "Downloading layer" >&2
+echo sha512-0123abcd
+`)
+
+	m := jobs.New(10)
+	defer m.Close()
+
+	job := m.Start(jobs.Fetch, "", func(ctx context.Context, progress func(string)) error {
+		id, err := api.Fetch(ctx, "docker://busybox", jobs.Output(ctx))
+		if err != nil {
+			return err
+		}
+		jobs.SetImage(ctx, id)
+		return nil
+	})
+	job, err := m.Wait(context.Background(), job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Image != "sha512-0123abcd" {
+		t.Errorf("image %q", job.Image)
+	}
+	// stdout and stderr are copied apart, so their lines may interleave.
+	got := append([]string(nil), job.Output...)
+	sort.Strings(got)
+	want := []string{
+		"Downloading layer",
+		"args: fetch --insecure-options=image,tls --full -- docker://busybox",
+		"sha512-0123abcd",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output %q, want %q", job.Output, want)
+	}
+}
+
+func TestFetchFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name:   "exit status",
+			script: "echo 'no such image' >&2\nexit 1\n",
+			want:   "exit status 1",
+		},
+		{
+			name:   "no image id",
+			script: "echo done\n",
+			want:   "no image id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := fakeRkt(t, tt.script)
+
+			_, err := api.Fetch(context.Background(), "example.com/app:v1", ioutil.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want %q", err, tt.want)
+			}
+			if errors.Is(err, ErrTimeout) {
+				t.Errorf("err %v is a timeout", err)
+			}
+		})
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	api := fakeRkt(t, "exec sleep 10\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := api.Fetch(ctx, "example.com/app:v1", ioutil.Discard); !errors.Is(err, ErrTimeout) {
+		t.Errorf("err %v, want %v", err, ErrTimeout)
+	}
+}
@@ -0,0 +1,186 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/mix3/phantasma/rkt/api/v1alpha"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	maxStartupBackoff = 30 * time.Second
+	pingTimeout       = 5 * time.Second
+)
+
+type Info struct {
+	RktVersion  string `json:"rkt_version"`
+	AppcVersion string `json:"appc_version"`
+	ApiVersion  string `json:"api_version"`
+}
+
+type Check struct {
+	OK    bool   `json:"ok"`
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type Health struct {
+	Rkt  Check `json:"rkt"`
+	Dbus Check `json:"dbus"`
+}
+
+func (h Health) OK() bool {
+	return h.Rkt.OK && h.Dbus.OK
+}
+
+func (api *Api) GetInfo(ctx context.Context) (Info, error) {
+	ctx, cancel := api.rpcContext(ctx)
+	defer cancel()
+
+	res, err := api.apiClient.GetInfo(ctx, &v1alpha.GetInfoRequest{})
+	if err != nil {
+		return Info{}, callError(ctx, "GetInfo", err)
+	}
+
+	info := res.GetInfo()
+	if info == nil {
+		return Info{}, fmt.Errorf("could not GetInfo: empty response")
+	}
+
+	return Info{
+		RktVersion:  info.RktVersion,
+		AppcVersion: info.AppcVersion,
+		ApiVersion:  info.ApiVersion,
+	}, nil
+}
+
+// WaitReady retries GetInfo with backoff until the rkt api answers or ctx is
+// done.
+func (api *Api) WaitReady(ctx context.Context) error {
+	delay := time.Second
+	for {
+		info, err := api.GetInfo(ctx)
+		if err == nil {
+			log.Printf("[rktapi] connected to rkt %s (api %s)", info.RktVersion, info.ApiVersion)
+			return nil
+		}
+
+		log.Printf("[rktapi] waiting for %s: %v", api.apiEndpoint, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("rkt api not ready: %v", err)
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; maxStartupBackoff < delay {
+			delay = maxStartupBackoff
+		}
+	}
+}
+
+func (api *Api) Health(ctx context.Context) Health {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	h := Health{
+		Rkt: Check{
+			State: api.grpcConn.GetState().String(),
+		},
+	}
+
+	if _, err := api.GetInfo(ctx); err != nil {
+		h.Rkt.Error = err.Error()
+	} else {
+		h.Rkt.OK = true
+	}
+
+	if err := api.pingDbus(ctx); err != nil {
+		h.Dbus.Error = err.Error()
+	} else {
+		h.Dbus.OK = true
+	}
+
+	return h
+}
+
+// watchRkt logs the state of the rkt api connection and reconnects an idle
+// one right away, so that health checks see it as it is.
+func (api *Api) watchRkt() {
+	state := api.grpcConn.GetState()
+	for api.grpcConn.WaitForStateChange(api.ctx, state) {
+		state = api.grpcConn.GetState()
+		log.Printf("[rktapi] connection %s", state)
+
+		switch state {
+		case connectivity.Idle:
+			api.grpcConn.Connect()
+		case connectivity.Shutdown:
+			return
+		}
+	}
+}
+
+// watchDbus checks the systemd connection every --health-interval and
+// reconnects when it is broken, e.g. after systemd was re-executed.
+func (api *Api) watchDbus() {
+	if api.opts.HealthInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(api.opts.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-api.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(api.ctx, pingTimeout)
+		err := api.pingDbus(ctx)
+		cancel()
+		if err == nil || api.ctx.Err() != nil {
+			continue
+		}
+
+		log.Printf("[rktapi] dbus: %v, reconnecting", err)
+		if err := api.reconnectDbus(); err != nil {
+			log.Printf("[rktapi] dbus: %v", err)
+		}
+	}
+}
+
+func (api *Api) pingDbus(ctx context.Context) error {
+	return api.dbusCall(ctx, "SystemState", func(conn *dbus.Conn) error {
+		_, err := conn.SystemState()
+		return err
+	})
+}
+
+func (api *Api) reconnectDbus() error {
+	conn, err := dbus.New()
+	if err != nil {
+		return fmt.Errorf("did not connect: dbus %v", err)
+	}
+
+	api.dbusMu.Lock()
+	old := api.dbusConn
+	api.dbusConn = conn
+	api.dbusMu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+func (api *Api) systemd() *dbus.Conn {
+	api.dbusMu.Lock()
+	defer api.dbusMu.Unlock()
+
+	return api.dbusConn
+}
@@ -0,0 +1,216 @@
+package apis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mix3/phantasma/rkt/api/v1alpha"
+)
+
+// podCache holds the running pods of phantasma. Pods are inspected and their
+// manifests parsed once per uuid; the view by subdomain is rebuilt from
+// ListPods when it is older than the ttl or after it was invalidated by a
+// launch, a stop, an event or pods found done starting. Pods that exit on
+// their own are noticed only through the ttl.
+type podCache struct {
+	refreshMu sync.Mutex
+
+	mu      sync.Mutex
+	pods    map[string]PodInfo
+	view    map[string]PodInfo
+	updated time.Time
+	gen     int
+
+	starting map[string]bool
+}
+
+func (c *podCache) get(ttl time.Duration) (map[string]PodInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.view == nil || c.updated.IsZero() || ttl < time.Since(c.updated) {
+		return nil, false
+	}
+	return c.view, true
+}
+
+func (c *podCache) known(id string) (PodInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, ok := c.pods[id]
+	return info, ok
+}
+
+func (c *podCache) generation() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// set stores pods listed at generation gen. The view stays stale when the
+// cache was invalidated meanwhile, so that the next call lists again.
+func (c *podCache) set(pods map[string]PodInfo, gen int) map[string]PodInfo {
+	view := make(map[string]PodInfo)
+	for _, info := range pods {
+		view[info.Subdomain] = mergeReplica(view[info.Subdomain], info)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pods = pods
+	c.view = view
+	if c.gen == gen {
+		c.updated = time.Now()
+	}
+	return view
+}
+
+// setStarting records whether pods of subdomain are starting, and drops the
+// cache when they stopped starting: they run or failed since it was listed.
+func (c *podCache) setStarting(subdomain string, starting bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if starting {
+		if c.starting == nil {
+			c.starting = make(map[string]bool)
+		}
+		c.starting[subdomain] = true
+		return
+	}
+	if c.starting[subdomain] {
+		delete(c.starting, subdomain)
+		c.updated = time.Time{}
+		c.gen++
+	}
+}
+
+func (c *podCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updated = time.Time{}
+	c.gen++
+}
+
+// InvalidatePods drops the cached pods, so that the next call lists them
+// again.
+func (api *Api) InvalidatePods() {
+	api.pods.invalidate()
+}
+
+// podView returns the cached view, refreshing it when it is stale. Concurrent
+// callers share one refresh.
+func (api *Api) podView(ctx context.Context) (map[string]PodInfo, error) {
+	if view, ok := api.pods.get(api.opts.PodCacheTTL); ok {
+		return view, nil
+	}
+
+	api.pods.refreshMu.Lock()
+	defer api.pods.refreshMu.Unlock()
+
+	if view, ok := api.pods.get(api.opts.PodCacheTTL); ok {
+		return view, nil
+	}
+	return api.refreshPods(ctx)
+}
+
+func (api *Api) refreshPods(ctx context.Context) (map[string]PodInfo, error) {
+	gen := api.pods.generation()
+
+	rpcCtx, cancel := api.rpcContext(ctx)
+	res, err := api.apiClient.ListPods(
+		rpcCtx,
+		&v1alpha.ListPodsRequest{
+			Filter: &v1alpha.PodFilter{
+				States: []v1alpha.PodState{v1alpha.PodState_POD_STATE_RUNNING},
+				Annotations: []*v1alpha.KeyValue{
+					{
+						Key:   api.opts.Specific + "-is",
+						Value: "1",
+					},
+				},
+			},
+		},
+	)
+	cancel()
+	if err != nil {
+		return nil, callError(rpcCtx, "ListPodsRequest", err)
+	}
+
+	pods := make(map[string]PodInfo)
+	var ids []string
+	for _, pod := range res.GetPods() {
+		if info, ok := api.pods.known(pod.Id); ok {
+			pods[pod.Id] = info
+		} else {
+			ids = append(ids, pod.Id)
+		}
+	}
+
+	inspected, err := api.inspectPods(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range inspected {
+		pods[info.Uuid] = info
+	}
+
+	return api.pods.set(pods, gen), nil
+}
+
+// inspectPods inspects pods ids with at most --rkt-api-concurrency calls at a
+// time.
+func (api *Api) inspectPods(ctx context.Context, ids []string) ([]PodInfo, error) {
+	concurrency := api.opts.RktApiConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		result   []PodInfo
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, id := range ids {
+		sem <- struct{}{}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, cancel := api.rpcContext(ctx)
+			defer cancel()
+
+			res, err := api.apiClient.InspectPod(
+				ctx,
+				&v1alpha.InspectPodRequest{
+					Id: id,
+				},
+			)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if firstErr == nil {
+					firstErr = callError(ctx, "InspectPodRequest", err)
+				}
+				return
+			}
+			if pod := res.GetPod(); pod != nil {
+				result = append(result, api.podToPodInfo(pod))
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	return result, firstErr
+}
@@ -0,0 +1,75 @@
+package apis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mix3/phantasma/options"
+	"github.com/mix3/phantasma/rkt/api/v1alpha"
+	"google.golang.org/grpc"
+)
+
+// fakeAPIClient answers ListPods with pods; other calls are not expected.
+type fakeAPIClient struct {
+	v1alpha.PublicAPIClient
+	pods []*v1alpha.Pod
+}
+
+func (c *fakeAPIClient) ListPods(ctx context.Context, in *v1alpha.ListPodsRequest, opts ...grpc.CallOption) (*v1alpha.ListPodsResponse, error) {
+	return &v1alpha.ListPodsResponse{Pods: c.pods}, nil
+}
+
+func TestStartingInvalidatesPods(t *testing.T) {
+	client := &fakeAPIClient{}
+	api := &Api{
+		apiClient: client,
+		opts:      options.Options{Specific: "phantasma", PodCacheTTL: time.Minute},
+	}
+
+	cached := func() bool {
+		_, ok := api.pods.get(api.opts.PodCacheTTL)
+		return ok
+	}
+	starting := func(want bool) {
+		t.Helper()
+		got, err := api.Starting(context.Background(), "app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("starting %v, want %v", got, want)
+		}
+	}
+
+	if _, err := api.PodInfoMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	starting(false)
+	if !cached() {
+		t.Error("pods dropped without a starting pod")
+	}
+
+	// Pods starting keep the cache, however often they are asked for.
+	client.pods = []*v1alpha.Pod{{Id: "uuid", State: v1alpha.PodState_POD_STATE_PREPARING}}
+	starting(true)
+	starting(true)
+	if !cached() {
+		t.Error("pods dropped while a pod is starting")
+	}
+
+	// Once they are done, the cache is dropped once.
+	client.pods = nil
+	starting(false)
+	if cached() {
+		t.Error("pods still cached after a pod started")
+	}
+	if _, err := api.PodInfoMap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	starting(false)
+	if !cached() {
+		t.Error("pods dropped again")
+	}
+}
@@ -6,19 +6,37 @@ import (
 	"strings"
 
 	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/accesslog"
 	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/capture"
+	"github.com/mix3/phantasma/events"
 	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/httpcache"
+	"github.com/mix3/phantasma/jobs"
+	"github.com/mix3/phantasma/maintenance"
+	"github.com/mix3/phantasma/metrics"
 	"github.com/mix3/phantasma/options"
 	"github.com/mix3/phantasma/rproxy"
+	"github.com/mix3/phantasma/tcpproxy"
 	"github.com/unrolled/render"
 )
 
 type Apps struct {
-	mux    *http.ServeMux
-	render *render.Render
-	api    *apis.Api
-	rp     *rproxy.ReverseProxy
-	opts   options.Options
+	mux       *http.ServeMux
+	handler   http.Handler
+	render    *render.Render
+	api       *apis.Api
+	rp        *rproxy.ReverseProxy
+	tcp       *tcpproxy.TCPProxy
+	accessLog *accesslog.Logger
+	events    *events.Bus
+	jobs      *jobs.Manager
+	routes    []route
+	patterns  []string
+	spec      map[string]interface{}
+	opts      options.Options
+
+	unsubscribe func()
 }
 
 func New(api *apis.Api, opts options.Options) (*Apps, error) {
@@ -27,80 +45,461 @@ func New(api *apis.Api, opts options.Options) (*Apps, error) {
 		return nil, err
 	}
 
+	tcp, err := tcpproxy.New(api, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	accessLog, err := accesslog.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	accessLog.AddHook(metrics.ObserveRequest)
+
+	if err := metrics.RegisterEnvironments(rp.Count); err != nil {
+		return nil, err
+	}
+
 	a := &Apps{
-		mux:    http.NewServeMux(),
-		render: render.New(render.Options{}),
-		api:    api,
-		rp:     rp,
-		opts:   opts,
-	}
-	a.mux.HandleFunc("/api/launch", a.launch)
-	a.mux.HandleFunc("/api/terminate", a.terminate)
-	a.mux.HandleFunc("/api/image/list", a.imageList)
-	a.mux.HandleFunc("/api/list", a.list)
-	a.mux.Handle("/", http.FileServer(http.Dir(opts.StaticDir)))
+		mux:       http.NewServeMux(),
+		render:    render.New(render.Options{}),
+		api:       api,
+		rp:        rp,
+		tcp:       tcp,
+		accessLog: accessLog,
+		events:    events.New(),
+		jobs:      jobs.New(opts.JobHistory),
+		opts:      opts,
+	}
+	a.registerRoutes()
+	a.handler = accessLog.Handler(http.HandlerFunc(a.route))
+
+	ch, unsubscribe := a.events.Subscribe()
+	a.unsubscribe = unsubscribe
+	go a.invalidatePods(ch)
+
 	return a, nil
 }
 
-func (a *Apps) launch(w http.ResponseWriter, r *http.Request) {
-	launchForm := &forms.LaunchForm{
-		Port: a.opts.DefaultPort,
-		Net:  a.opts.DefaultNet,
+// invalidatePods drops the pod cache whenever an environment is launched or
+// terminated, so that listings do not wait for --pod-cache-ttl.
+func (a *Apps) invalidatePods(ch <-chan events.Event) {
+	for e := range ch {
+		switch e.Type {
+		case events.Launched, events.Terminated:
+			a.api.InvalidatePods()
+		}
 	}
+}
+
+// dispatchPatterns are the mux patterns served by dispatch from a.routes.
+var dispatchPatterns = []string{"/api/v1/", "/api/jobs", "/api/jobs/", "/api/images"}
+
+// registerRoutes registers the handlers on the mux and describes them in the
+// OpenAPI spec. Everything not matched by a route is a static file.
+func (a *Apps) registerRoutes() {
+	a.routes = append(append(a.v1Routes(), a.jobRoutes()...), a.imageRoutes()...)
+	for _, v := range dispatchPatterns {
+		a.handle(v, a.dispatch)
+	}
+
+	others := append(a.legacyRoutes(), a.miscRoutes()...)
+	for _, v := range others {
+		handler := v.handler
+		a.handle(v.pattern, func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, nil)
+		})
+	}
+	a.spec = openAPISpec(append(a.routes, others...))
+
+	a.handle("/", http.FileServer(http.Dir(a.opts.StaticDir)).ServeHTTP)
+}
+
+func (a *Apps) handle(pattern string, handler http.HandlerFunc) {
+	a.mux.HandleFunc(pattern, handler)
+	a.patterns = append(a.patterns, pattern)
+}
+
+func (a *Apps) Close() {
+	a.unsubscribe()
+	a.jobs.Close()
+	a.rp.Close()
+	a.tcp.Close()
+	a.accessLog.Close()
+}
+
+func (a *Apps) newLaunchForm() *forms.LaunchForm {
+	return &forms.LaunchForm{
+		Net: a.opts.DefaultNet,
+	}
+}
+
+func (a *Apps) launch(w http.ResponseWriter, r *http.Request) {
+	launchForm := a.newLaunchForm()
 	errs := binding.Bind(r, launchForm)
 	if 0 < errs.Len() {
 		a.renderErr(w, errs)
 		return
 	}
 
-	var err error
-	if launchForm.ImageId != "" {
-		err = a.api.RunByImageId(
-			launchForm.ImageId,
-			launchForm.Subdomain,
-			fmt.Sprintf("%d", launchForm.Port),
-			launchForm.Net,
-			launchForm.Envs,
-		)
+	job, err := a.startLaunch(jobs.Launch, launchForm)
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderJob(w, r, job)
+}
+
+func (a *Apps) terminate(w http.ResponseWriter, r *http.Request) {
+	terminateForm := new(forms.TerminateForm)
+	errs := binding.Bind(r, terminateForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.renderJob(w, r, a.startTerminate(terminateForm.Subdomain))
+}
+
+func (a *Apps) redeploy(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	job, err := a.startRedeploy(r.Context(), subdomainForm.Subdomain)
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderJob(w, r, job)
+}
+
+func (a *Apps) split(w http.ResponseWriter, r *http.Request) {
+	splitForm := new(forms.SplitForm)
+	errs := binding.Bind(r, splitForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.rp.SetSplit(splitForm.Subdomain, splitForm.Variants)
+
+	a.renderOK(w)
+}
+
+func (a *Apps) splitDelete(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	if err := a.rp.DelSplit(subdomainForm.Subdomain); err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) mirror(w http.ResponseWriter, r *http.Request) {
+	mirrorForm := &forms.MirrorForm{
+		Rate:    1,
+		MaxBody: a.opts.MirrorMaxBody,
+	}
+	errs := binding.Bind(r, mirrorForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.rp.SetMirror(mirrorForm.Subdomain, forms.Mirror{
+		Target:  mirrorForm.Target,
+		Rate:    mirrorForm.Rate,
+		MaxBody: mirrorForm.MaxBody,
+	})
+
+	a.renderOK(w)
+}
+
+func (a *Apps) mirrorDelete(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	if err := a.rp.DelMirror(subdomainForm.Subdomain); err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) capture(w http.ResponseWriter, r *http.Request) {
+	captureForm := &forms.CaptureForm{
+		Size:    a.opts.CaptureSize,
+		MaxBody: a.opts.CaptureMaxBody,
+	}
+	errs := binding.Bind(r, captureForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.rp.Captures().Enable(captureForm.Subdomain, capture.Config{
+		Size:        captureForm.Size,
+		MaxBody:     captureForm.MaxBody,
+		Credentials: captureForm.Credentials,
+	})
+
+	a.renderOK(w)
+}
+
+func (a *Apps) captureDelete(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	if err := a.rp.Captures().Disable(subdomainForm.Subdomain); err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) captureList(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	list, err := a.rp.Captures().List(subdomainForm.Subdomain)
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string][]*capture.Capture{
+		"result": list,
+	})
+}
+
+func (a *Apps) captureHAR(w http.ResponseWriter, r *http.Request) {
+	captureQueryForm := new(forms.CaptureQueryForm)
+	errs := binding.Bind(r, captureQueryForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	var (
+		list []*capture.Capture
+		err  error
+	)
+	if captureQueryForm.Id != "" {
+		var c *capture.Capture
+		c, err = a.rp.Captures().Get(captureQueryForm.Subdomain, captureQueryForm.Id)
+		list = []*capture.Capture{c}
 	} else {
-		err = a.api.RunByImageName(
-			launchForm.ImageName,
-			launchForm.Subdomain,
-			fmt.Sprintf("%d", launchForm.Port),
-			launchForm.Net,
-			launchForm.Envs,
-		)
+		list, err = a.rp.Captures().List(captureQueryForm.Subdomain)
+	}
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s.har"`, captureQueryForm.Subdomain),
+	)
+	a.render.JSON(w, http.StatusOK, capture.ToHAR(list))
+}
+
+func (a *Apps) captureReplay(w http.ResponseWriter, r *http.Request) {
+	replayForm := new(forms.ReplayForm)
+	errs := binding.Bind(r, replayForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	c, err := a.rp.Captures().Get(replayForm.Subdomain, replayForm.Id)
+	if err != nil {
+		a.renderErr(w, err)
+		return
 	}
+
+	target := replayForm.Target
+	if target == "" {
+		target = replayForm.Subdomain
+	}
+
+	result, err := a.rp.Replay(c, target)
 	if err != nil {
 		a.renderErr(w, err)
 		return
 	}
 
-	a.rp.Add(launchForm.Subdomain)
+	a.render.JSON(w, http.StatusOK, map[string]rproxy.ReplayResult{
+		"result": result,
+	})
+}
+
+func (a *Apps) compress(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.rp.SetCompress(subdomainForm.Subdomain, true)
 
 	a.renderOK(w)
 }
 
-func (a *Apps) terminate(w http.ResponseWriter, r *http.Request) {
-	terminateForm := new(forms.TerminateForm)
-	errs := binding.Bind(r, terminateForm)
+func (a *Apps) compressDelete(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.rp.SetCompress(subdomainForm.Subdomain, false)
+
+	a.renderOK(w)
+}
+
+func (a *Apps) cache(w http.ResponseWriter, r *http.Request) {
+	cacheForm := &forms.CacheForm{
+		MaxSize:  a.opts.CacheSize,
+		MaxEntry: a.opts.CacheMaxEntry,
+	}
+	errs := binding.Bind(r, cacheForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	err := a.rp.SetCache(cacheForm.Subdomain, httpcache.Config{
+		MaxSize:  int64(cacheForm.MaxSize),
+		MaxEntry: int64(cacheForm.MaxEntry),
+		Disk:     cacheForm.Disk,
+	})
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) cacheDelete(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	if err := a.rp.DelCache(subdomainForm.Subdomain); err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) cachePurge(w http.ResponseWriter, r *http.Request) {
+	subdomainForm := new(forms.SubdomainForm)
+	errs := binding.Bind(r, subdomainForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	if err := a.rp.PurgeCache(subdomainForm.Subdomain); err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.renderOK(w)
+}
+
+func (a *Apps) maintenance(w http.ResponseWriter, r *http.Request) {
+	maintenanceForm := &forms.MaintenanceForm{
+		RetryAfter: 300,
+	}
+	errs := binding.Bind(r, maintenanceForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	err := a.rp.Maintenance().Set(maintenanceForm.Subdomain, maintenance.Entry{
+		Message:    maintenanceForm.Message,
+		RetryAfter: maintenanceForm.RetryAfter,
+	})
+	if err != nil {
+		a.renderErr(w, err)
+		return
+	}
+
+	a.events.Publish(events.Event{
+		Type:      events.MaintenanceEnabled,
+		Subdomain: maintenanceForm.Subdomain,
+		Message:   maintenanceForm.Message,
+	})
+
+	a.renderOK(w)
+}
+
+func (a *Apps) maintenanceDelete(w http.ResponseWriter, r *http.Request) {
+	maintenanceForm := new(forms.MaintenanceForm)
+	errs := binding.Bind(r, maintenanceForm)
 	if 0 < errs.Len() {
 		a.renderErr(w, errs)
 		return
 	}
 
-	if err := a.api.Stop(terminateForm.Subdomain); err != nil {
+	if err := a.rp.Maintenance().Del(maintenanceForm.Subdomain); err != nil {
 		a.renderErr(w, err)
 		return
 	}
 
-	a.rp.Del(terminateForm.Subdomain)
+	a.events.Publish(events.Event{
+		Type:      events.MaintenanceDisabled,
+		Subdomain: maintenanceForm.Subdomain,
+	})
 
 	a.renderOK(w)
 }
 
+func (a *Apps) maintenanceList(w http.ResponseWriter, r *http.Request) {
+	a.render.JSON(w, http.StatusOK, map[string]maintenance.State{
+		"result": a.rp.Maintenance().State(),
+	})
+}
+
 func (a *Apps) imageList(w http.ResponseWriter, r *http.Request) {
-	imageList, err := a.api.ImageList()
+	imageList, err := a.api.ImageList(r.Context())
 	if err != nil {
 		a.renderErr(w, err)
 		return
@@ -111,8 +510,31 @@ func (a *Apps) imageList(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (a *Apps) info(w http.ResponseWriter, r *http.Request) {
+	info, err := a.api.GetInfo(r.Context())
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string]apis.Info{
+		"result": info,
+	})
+}
+
+func (a *Apps) healthz(w http.ResponseWriter, r *http.Request) {
+	health := a.api.Health(r.Context())
+
+	status := http.StatusOK
+	if !health.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	a.render.JSON(w, status, health)
+}
+
 func (a *Apps) list(w http.ResponseWriter, r *http.Request) {
-	list, err := a.rp.List()
+	list, err := a.rp.List(r.Context())
 	if err != nil {
 		a.renderErr(w, err)
 		return
@@ -123,10 +545,41 @@ func (a *Apps) list(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (a *Apps) accessLogList(w http.ResponseWriter, r *http.Request) {
+	accessLogForm := new(forms.AccessLogForm)
+	errs := binding.Bind(r, accessLogForm)
+	if 0 < errs.Len() {
+		a.renderErr(w, errs)
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string][]accesslog.Entry{
+		"result": a.accessLog.Recent(accessLogForm.Subdomain, accessLogForm.Limit),
+	})
+}
+
 func (a *Apps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.ServeHTTP(w, r)
+}
+
+func (a *Apps) route(w http.ResponseWriter, r *http.Request) {
 	host := strings.Split(r.Host, ":")[0]
 	suffix := "." + a.opts.Domain
 
+	if subdomain, ok := a.rp.Lookup(host); ok {
+		a.rp.ServeHTTPWithSubdomain(w, r, subdomain)
+		return
+	}
+
+	if subdomain, ok := a.pathSubdomain(host, r.URL.Path); ok {
+		if subdomain == "" {
+			a.rp.NotFound(w, r, subdomain)
+			return
+		}
+		a.rp.ServeHTTPWithPrefix(w, r, subdomain, a.pathPrefix()+subdomain)
+		return
+	}
+
 	switch {
 	case host == a.opts.Domain:
 		a.mux.ServeHTTP(w, r)
@@ -135,9 +588,27 @@ func (a *Apps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		subdomain := strings.TrimSuffix(host, suffix)
 		a.rp.ServeHTTPWithSubdomain(w, r, subdomain)
 
+	case r.URL.Path == "/healthz":
+		// Load balancers usually check by address rather than by domain.
+		a.healthz(w, r)
+
 	default:
-		http.NotFound(w, r)
+		a.rp.NotFound(w, r, host)
+	}
+}
+
+// pathSubdomain returns the subdomain of a path routed request. Path routing
+// applies on the management domain and on hosts outside of it only, so that
+// the paths of an environment stay its own.
+func (a *Apps) pathSubdomain(host, path string) (string, bool) {
+	if !a.opts.PathRouting || strings.HasSuffix(host, "."+a.opts.Domain) || !strings.HasPrefix(path, a.pathPrefix()) {
+		return "", false
 	}
+	return strings.SplitN(strings.TrimPrefix(path, a.pathPrefix()), "/", 2)[0], true
+}
+
+func (a *Apps) pathPrefix() string {
+	return "/" + strings.Trim(a.opts.PathPrefix, "/") + "/"
 }
 
 func (a *Apps) renderOK(w http.ResponseWriter) {
@@ -146,6 +617,23 @@ func (a *Apps) renderOK(w http.ResponseWriter) {
 	})
 }
 
+// renderJob answers the legacy endpoints as before jobs: "ok" once job is
+// done, or the error it failed with. With async=true it answers "ok" as soon
+// as the job is started.
+func (a *Apps) renderJob(w http.ResponseWriter, r *http.Request, job jobs.Job) {
+	if !async(r) {
+		if err := a.waitJob(r, job); err != nil {
+			a.renderErr(w, err)
+			return
+		}
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string]string{
+		"result": "ok",
+		"job":    job.Id,
+	})
+}
+
 func (a *Apps) renderErr(w http.ResponseWriter, err error) {
 	a.render.JSON(w, http.StatusOK, map[string]string{
 		"result": err.Error(),
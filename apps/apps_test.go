@@ -0,0 +1,35 @@
+package apps
+
+import (
+	"testing"
+
+	"github.com/mix3/phantasma/options"
+)
+
+func TestPathSubdomain(t *testing.T) {
+	a := &Apps{opts: options.Options{Domain: "example.com", PathRouting: true, PathPrefix: "_"}}
+
+	tests := []struct {
+		host, path string
+		subdomain  string
+		ok         bool
+	}{
+		{"example.com", "/_/app/x", "app", true},
+		{"10.0.0.1", "/_/app/", "app", true},
+		{"example.com", "/_/", "", true},
+		{"example.com", "/api/list", "", false},
+		{"foo.example.com", "/_/bar/x", "", false},
+		{"api.foo.example.com", "/_/bar/x", "", false},
+	}
+	for _, tt := range tests {
+		subdomain, ok := a.pathSubdomain(tt.host, tt.path)
+		if subdomain != tt.subdomain || ok != tt.ok {
+			t.Errorf("%s%s: %q, %v, want %q, %v", tt.host, tt.path, subdomain, ok, tt.subdomain, tt.ok)
+		}
+	}
+
+	a.opts.PathRouting = false
+	if _, ok := a.pathSubdomain("example.com", "/_/app/x"); ok {
+		t.Error("path routed without --path-routing")
+	}
+}
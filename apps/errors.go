@@ -0,0 +1,84 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/apis"
+)
+
+type fieldError struct {
+	Fields         []string `json:"fields"`
+	Classification string   `json:"classification"`
+	Message        string   `json:"message"`
+}
+
+// apiError is the error body of the /api/v1 endpoints. Its message is the
+// text of the underlying error, so the legacy endpoints render it unchanged.
+type apiError struct {
+	status  int
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, code string, err error) *apiError {
+	return &apiError{
+		status:  status,
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+func badRequest(err error) error {
+	return newAPIError(http.StatusBadRequest, "invalid_request", err)
+}
+
+func notFound(err error) error {
+	return newAPIError(http.StatusNotFound, "not_found", err)
+}
+
+func conflict(err error) error {
+	return newAPIError(http.StatusConflict, "conflict", err)
+}
+
+func toAPIError(err error) *apiError {
+	var e *apiError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var errs binding.Errors
+	if errors.As(err, &errs) {
+		e := newAPIError(http.StatusUnprocessableEntity, "validation_failed", err)
+		if errs.Has(binding.DeserializationError) || errs.Has(binding.ContentTypeError) {
+			e.status = http.StatusBadRequest
+			e.Code = "invalid_request"
+		}
+		for _, v := range errs {
+			e.Fields = append(e.Fields, fieldError{
+				Fields:         v.FieldNames,
+				Classification: v.Classification,
+				Message:        v.Message,
+			})
+		}
+		return e
+	}
+
+	switch {
+	case errors.Is(err, apis.ErrImageNotFound):
+		return newAPIError(http.StatusUnprocessableEntity, "image_not_found", err)
+	case errors.Is(err, apis.ErrImageDuplicated):
+		return newAPIError(http.StatusUnprocessableEntity, "image_duplicated", err)
+	case errors.Is(err, apis.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return newAPIError(http.StatusGatewayTimeout, "timeout", err)
+	}
+
+	return newAPIError(http.StatusInternalServerError, "internal_error", err)
+}
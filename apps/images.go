@@ -0,0 +1,234 @@
+package apps
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/forms"
+)
+
+func (a *Apps) imageRoutes() []route {
+	return []route{
+		{
+			method:  "POST",
+			pattern: "/api/images",
+			summary: "Upload an image archive as the image part of a multipart body or as the body, and import it with rkt fetch. ACI archives and uncompressed docker save archives, converted with docker2aci, are accepted; other archives answer 415 (with async=true, answer 202 with the job)",
+			form:    new(forms.UploadForm),
+			upload:  true,
+			status:  http.StatusCreated,
+			result:  apis.ImageInfo{},
+			handler: a.uploadImage,
+		},
+	}
+}
+
+func (a *Apps) uploadImage(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	// The checks are bound from the query alone, so that the body is read
+	// only once, while it is stored.
+	uploadForm := new(forms.UploadForm)
+	query := &http.Request{Method: "GET", URL: r.URL, Header: http.Header{}}
+	if errs := binding.Bind(query, uploadForm); 0 < errs.Len() {
+		a.renderError(w, errs)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.opts.UploadMaxSize)
+	body, err := uploadBody(r)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	path, format, err := a.storeUpload(body, uploadForm)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	job := a.startFetch(path, format == formatDocker, func() {
+		os.Remove(path)
+	})
+	if async(r) {
+		a.renderAccepted(w, job)
+		return
+	}
+	a.renderFetched(w, r, job)
+}
+
+// uploadBody returns the archive: the image part of a multipart body or the
+// body itself.
+func uploadBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, badRequest(fmt.Errorf("no image part in the multipart body"))
+		}
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		if part.FormName() == "image" {
+			return part, nil
+		}
+	}
+}
+
+// storeUpload writes body to a file under --tmp-dir, checks it against
+// uploadForm and returns its format. The file is removed unless it passes.
+func (a *Apps) storeUpload(body io.Reader, uploadForm *forms.UploadForm) (string, string, error) {
+	f, err := ioutil.TempFile(a.opts.TmpDir, a.opts.Specific+"-upload-")
+	if err != nil {
+		return "", "", err
+	}
+
+	sha256Hash := sha256.New()
+	sha512Hash := sha512.New()
+	size, err := io.Copy(io.MultiWriter(f, sha256Hash, sha512Hash), body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		err = newAPIError(
+			http.StatusRequestEntityTooLarge,
+			"too_large",
+			fmt.Errorf("archive larger than %d bytes", a.opts.UploadMaxSize),
+		)
+	case err != nil:
+	case size == 0:
+		err = badRequest(fmt.Errorf("empty archive"))
+	case 0 < uploadForm.Size && size != uploadForm.Size:
+		err = newAPIError(
+			http.StatusUnprocessableEntity,
+			"size_mismatch",
+			fmt.Errorf("archive is %d bytes, expected %d", size, uploadForm.Size),
+		)
+	case uploadForm.SHA256 != "" && hex.EncodeToString(sha256Hash.Sum(nil)) != uploadForm.SHA256:
+		err = newAPIError(http.StatusUnprocessableEntity, "checksum_mismatch", fmt.Errorf("sha256 of the archive does not match"))
+	case uploadForm.SHA512 != "" && hex.EncodeToString(sha512Hash.Sum(nil)) != uploadForm.SHA512:
+		err = newAPIError(http.StatusUnprocessableEntity, "checksum_mismatch", fmt.Errorf("sha512 of the archive does not match"))
+	}
+	var format string
+	if err == nil {
+		format, err = imageFormat(f.Name())
+	}
+	if err == nil && format == formatDocker && a.opts.Docker2aci == "" {
+		err = unsupportedImage(fmt.Errorf("docker archives require --docker2aci"))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+
+	// rkt fetch tells files from image names by their path, and docker2aci
+	// runs in another directory, so they get an absolute one.
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return path, format, nil
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+const (
+	formatACI    = "aci"
+	formatDocker = "docker"
+)
+
+// imageFormat tells an ACI, a tar, possibly compressed, with a manifest
+// entry, from an uncompressed docker save archive, which has manifest.json
+// and repositories entries instead. Anything else is not supported.
+func imageFormat(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(xzMagic))
+
+	var (
+		r          io.Reader = br
+		compressed           = true
+	)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return "", unsupportedImage(err)
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(magic, bzip2Magic):
+		r = bzip2.NewReader(br)
+	case bytes.HasPrefix(magic, xzMagic):
+		// There is no xz reader in the standard library; rkt fetch checks
+		// the contents.
+		return formatACI, nil
+	default:
+		compressed = false
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", unsupportedImage(fmt.Errorf("neither an ACI nor a docker archive"))
+		}
+		if err != nil {
+			return "", unsupportedImage(err)
+		}
+		switch strings.TrimPrefix(path.Clean(hdr.Name), "./") {
+		case "manifest":
+			return formatACI, nil
+		case "manifest.json", "repositories":
+			if compressed {
+				return "", unsupportedImage(fmt.Errorf("docker archives must be uncompressed"))
+			}
+			return formatDocker, nil
+		}
+	}
+}
+
+func unsupportedImage(err error) error {
+	return newAPIError(
+		http.StatusUnsupportedMediaType,
+		"unsupported_image",
+		fmt.Errorf("unsupported image archive: %v", err),
+	)
+}
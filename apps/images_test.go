@@ -0,0 +1,77 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func tarball(t *testing.T, gz bool, names ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !gz {
+		return buf.Bytes()
+	}
+
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	zw.Write(buf.Bytes())
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zbuf.Bytes()
+}
+
+func TestImageFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive []byte
+		format  string
+	}{
+		{"aci", tarball(t, false, "manifest", "rootfs/"), formatACI},
+		{"gzipped aci", tarball(t, true, "./rootfs/", "./manifest"), formatACI},
+		{"docker", tarball(t, false, "repositories", "manifest.json", "0123/layer.tar"), formatDocker},
+		{"gzipped docker", tarball(t, true, "manifest.json"), ""},
+		{"no manifest", tarball(t, false, "rootfs/"), ""},
+		{"not a tar", []byte("hello, world\n"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "image")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.Write(tt.archive)
+			f.Close()
+
+			format, err := imageFormat(f.Name())
+			if tt.format != "" {
+				if err != nil || format != tt.format {
+					t.Errorf("format %q, err %v, want %q", format, err, tt.format)
+				}
+				return
+			}
+			if e := toAPIError(err); err == nil || e.status != http.StatusUnsupportedMediaType {
+				t.Errorf("err %v, want %d", err, http.StatusUnsupportedMediaType)
+			}
+		})
+	}
+}
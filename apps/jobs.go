@@ -0,0 +1,340 @@
+package apps
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/events"
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/jobs"
+)
+
+const (
+	runningPollInterval = time.Second
+	jobPollInterval     = time.Second
+)
+
+func (a *Apps) jobRoutes() []route {
+	return []route{
+		{
+			method:  "GET",
+			pattern: "/api/jobs",
+			summary: "List recent jobs",
+			result:  []jobs.Job{},
+			handler: a.jobList,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/jobs/{id}",
+			summary: "Get a job",
+			result:  jobs.Job{},
+			handler: a.jobGet,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/jobs/{id}/events",
+			summary: "Stream the progress of a job as server-sent events",
+			result:  jobs.Job{},
+			raw:     "text/event-stream",
+			handler: a.jobEvents,
+		},
+	}
+}
+
+// startLaunch checks the aliases of launchForm and launches it as a job.
+func (a *Apps) startLaunch(kind string, launchForm *forms.LaunchForm) (jobs.Job, error) {
+	if err := a.rp.CheckAliases(launchForm.Subdomain, launchForm.Aliases); err != nil {
+		return jobs.Job{}, conflict(err)
+	}
+
+	return a.jobs.Start(kind, launchForm.Subdomain, func(ctx context.Context, progress func(string)) error {
+		return a.launchEnvironment(ctx, launchForm, progress)
+	}), nil
+}
+
+func (a *Apps) startTerminate(subdomain string) jobs.Job {
+	return a.jobs.Start(jobs.Terminate, subdomain, func(ctx context.Context, progress func(string)) error {
+		progress(jobs.Stopping)
+		return a.terminateEnvironment(ctx, subdomain)
+	})
+}
+
+func (a *Apps) startRedeploy(ctx context.Context, subdomain string) (jobs.Job, error) {
+	info, ok, err := a.rp.Get(ctx, subdomain)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if !ok || !info.Running {
+		return jobs.Job{}, notFound(fmt.Errorf("environment not running: %s", subdomain))
+	}
+
+	return a.startLaunch(jobs.Redeploy, info.LaunchForm())
+}
+
+// startFetch fetches image into the rkt store as a job, converting it with
+// docker2aci first when it is a docker archive, and calls cleanup, if any,
+// once the job is over. Fetch jobs share the empty subdomain, so they run one
+// at a time.
+func (a *Apps) startFetch(image string, docker bool, cleanup func()) jobs.Job {
+	return a.jobs.StartWithCleanup(jobs.Fetch, "", func(ctx context.Context, progress func(string)) error {
+		fetchCtx, cancel := context.WithTimeout(ctx, a.opts.FetchTimeout)
+		defer cancel()
+
+		if docker {
+			progress(jobs.Converting)
+
+			aci, remove, err := a.api.Convert(fetchCtx, image, jobs.Output(ctx))
+			if err != nil {
+				return err
+			}
+			defer remove()
+			image = aci
+		}
+
+		progress(jobs.Fetching)
+
+		id, err := a.api.Fetch(fetchCtx, image, jobs.Output(ctx))
+		if err != nil {
+			return err
+		}
+		jobs.SetImage(ctx, id)
+
+		a.events.Publish(events.Event{
+			Type:    events.ImageFetched,
+			Message: id,
+		})
+
+		return nil
+	}, cleanup)
+}
+
+// renderFetched waits for a fetch job and answers with the image it fetched.
+func (a *Apps) renderFetched(w http.ResponseWriter, r *http.Request, job jobs.Job) {
+	job, err := a.jobs.Wait(r.Context(), job.Id)
+	if err == nil {
+		err = job.Err()
+	}
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	image, err := a.api.GetImage(r.Context(), job.Image)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.render.JSON(w, http.StatusCreated, map[string]apis.ImageInfo{
+		"result": image,
+	})
+}
+
+func (a *Apps) launchEnvironment(ctx context.Context, launchForm *forms.LaunchForm, progress func(string)) error {
+	tcp, err := a.tcp.Reserve(launchForm.Subdomain, launchForm.TCPForwards)
+	if err != nil {
+		return conflict(err)
+	}
+	launchForm.TCPForwards = tcp.Forwards
+
+	if err := a.api.Launch(ctx, launchForm, progress); err != nil {
+		tcp.Abort()
+		return err
+	}
+	tcp.Commit()
+
+	a.rp.Add(launchForm.Subdomain, launchForm.Aliases)
+
+	a.events.Publish(events.Event{
+		Type:      events.Launched,
+		Subdomain: launchForm.Subdomain,
+	})
+
+	progress(jobs.WaitingForRunning)
+
+	replicas := launchForm.Replicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+	return a.waitRunning(ctx, launchForm.Subdomain, replicas)
+}
+
+// waitRunning polls until replicas pods of subdomain run, for at most
+// --launch-timeout.
+func (a *Apps) waitRunning(ctx context.Context, subdomain string, replicas int) error {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.LaunchTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(runningPollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := a.api.GetPodInfo(ctx, subdomain)
+		if err != nil {
+			return err
+		}
+		if info.Running && replicas <= len(info.Replicas) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return newAPIError(
+				http.StatusGatewayTimeout,
+				"timeout",
+				fmt.Errorf("environment not running after %v: %s", a.opts.LaunchTimeout, subdomain),
+			)
+		case <-ticker.C:
+		}
+
+		// The cached pods are dropped once the pods are done starting.
+		if _, err := a.api.Starting(ctx, subdomain); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *Apps) terminateEnvironment(ctx context.Context, subdomain string) error {
+	if err := a.api.Stop(ctx, subdomain); err != nil {
+		return err
+	}
+
+	a.rp.Del(subdomain)
+	a.tcp.Release(subdomain)
+
+	a.events.Publish(events.Event{
+		Type:      events.Terminated,
+		Subdomain: subdomain,
+	})
+
+	return nil
+}
+
+// async reports whether the request asked not to wait for its job.
+func async(r *http.Request) bool {
+	b, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	return b
+}
+
+// renderAccepted answers an async request with the job it started.
+func (a *Apps) renderAccepted(w http.ResponseWriter, job jobs.Job) {
+	w.Header().Set("Location", "/api/jobs/"+job.Id)
+	a.render.JSON(w, http.StatusAccepted, map[string]jobs.Job{
+		"result": job,
+	})
+}
+
+// waitJob waits for job and returns the error it failed with.
+func (a *Apps) waitJob(r *http.Request, job jobs.Job) error {
+	job, err := a.jobs.Wait(r.Context(), job.Id)
+	if err != nil {
+		return err
+	}
+	return job.Err()
+}
+
+func (a *Apps) jobList(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	a.render.JSON(w, http.StatusOK, map[string][]jobs.Job{
+		"result": a.jobs.List(),
+	})
+}
+
+func (a *Apps) jobGet(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	job, err := a.jobs.Get(params["id"])
+	if err != nil {
+		a.renderError(w, notFound(err))
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string]jobs.Job{
+		"result": job,
+	})
+}
+
+// jobEvents streams the job as server-sent events until it is done: an event
+// named after each state it enters and an output event per line of output.
+func (a *Apps) jobEvents(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		a.renderError(w, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch, cancel := a.jobs.Subscribe()
+	defer cancel()
+
+	job, err := a.jobs.Get(params["id"])
+	if err != nil {
+		a.renderError(w, notFound(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	// Updates may be dropped when the stream falls behind, so the job is also
+	// checked periodically.
+	poll := time.NewTicker(jobPollInterval)
+	defer poll.Stop()
+
+	var (
+		state string
+		sent  int
+	)
+	for {
+		lines, n := job.Lines(sent)
+		for _, line := range lines {
+			if err := writeSSE(w, "output", line); err != nil {
+				return
+			}
+		}
+		sent = n
+
+		if job.State != state {
+			if err := writeSSE(w, job.State, job); err != nil {
+				return
+			}
+			state = job.State
+		}
+		flusher.Flush()
+		if job.Done() {
+			return
+		}
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-poll.C:
+				v, err := a.jobs.Get(job.Id)
+				if err != nil {
+					return
+				}
+				if !v.Updated.Equal(job.Updated) {
+					job = v
+					break wait
+				}
+			case v, ok := <-ch:
+				if !ok {
+					return
+				}
+				if v.Id == job.Id {
+					job = v
+					break wait
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package apps
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/binding"
+)
+
+type schema map[string]interface{}
+
+type specBuilder struct {
+	schemas schema
+	types   map[string]reflect.Type
+}
+
+// openAPISpec describes routes as an OpenAPI 3 document.
+func openAPISpec(routes []route) schema {
+	b := &specBuilder{
+		schemas: schema{},
+		types:   make(map[string]reflect.Type),
+	}
+
+	paths := schema{}
+	for _, v := range routes {
+		item, ok := paths[v.pattern].(schema)
+		if !ok {
+			item = schema{}
+			paths[v.pattern] = item
+		}
+		item[strings.ToLower(v.method)] = b.operation(v)
+	}
+
+	b.schemas["Error"] = schema{
+		"type": "object",
+		"properties": schema{
+			"error": b.schema(reflect.TypeOf(apiError{})),
+		},
+	}
+
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":   "phantasma",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": b.schemas,
+		},
+	}
+}
+
+func (b *specBuilder) operation(r route) schema {
+	op := schema{
+		"summary":     r.summary,
+		"operationId": operationId(r),
+	}
+	if r.legacy {
+		op["tags"] = []string{"legacy"}
+		op["description"] = "Errors are reported with status 200 and the error text as result."
+	} else if strings.HasPrefix(r.pattern, "/api/v1/") {
+		op["tags"] = []string{"v1"}
+	} else if strings.HasPrefix(r.pattern, "/api/jobs") {
+		op["tags"] = []string{"jobs"}
+	} else if strings.HasPrefix(r.pattern, "/api/images") {
+		op["tags"] = []string{"images"}
+	}
+
+	params := []schema{}
+	for _, v := range strings.Split(r.pattern, "/") {
+		if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+			params = append(params, schema{
+				"name":     v[1 : len(v)-1],
+				"in":       "path",
+				"required": true,
+				"schema":   schema{"type": "string"},
+			})
+		}
+	}
+
+	if r.form != nil {
+		form := formSchema(r.form, params)
+		required, _ := form["required"].([]string)
+		if r.method == "GET" || r.upload {
+			for _, name := range sortedKeys(form["properties"].(schema)) {
+				params = append(params, schema{
+					"name":     name,
+					"in":       "query",
+					"required": contains(required, name),
+					"schema":   form["properties"].(schema)[name],
+				})
+			}
+		} else {
+			content := schema{
+				"application/x-www-form-urlencoded": schema{"schema": form},
+			}
+			if r.body != nil {
+				content["application/json"] = schema{"schema": b.schema(reflect.TypeOf(r.body))}
+			}
+			op["requestBody"] = schema{
+				"required": true,
+				"content":  content,
+			}
+		}
+	}
+	if r.upload {
+		binary := schema{"type": "string", "format": "binary"}
+		op["requestBody"] = schema{
+			"required": true,
+			"content": schema{
+				"multipart/form-data": schema{"schema": schema{
+					"type":       "object",
+					"properties": schema{"image": binary},
+					"required":   []string{"image"},
+				}},
+				"application/octet-stream": schema{"schema": binary},
+			},
+		}
+	}
+	if 0 < len(params) {
+		op["parameters"] = params
+	}
+
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := schema{"description": http.StatusText(status)}
+	switch {
+	case r.raw != "" && r.result != nil:
+		res["content"] = schema{r.raw: schema{"schema": b.schema(reflect.TypeOf(r.result))}}
+	case r.raw != "":
+		res["content"] = schema{r.raw: schema{}}
+	case r.result != nil:
+		res["content"] = schema{"application/json": schema{"schema": schema{
+			"type": "object",
+			"properties": schema{
+				"result": b.schema(reflect.TypeOf(r.result)),
+			},
+		}}}
+	}
+	responses := schema{strconv.Itoa(status): res}
+	if op["tags"] != nil && !r.legacy {
+		responses["default"] = schema{
+			"description": "Error",
+			"content": schema{"application/json": schema{"schema": schema{
+				"$ref": "#/components/schemas/Error",
+			}}},
+		}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+func operationId(r route) string {
+	id := strings.ToLower(r.method)
+	for _, v := range strings.FieldsFunc(r.pattern, func(c rune) bool {
+		return c == '/' || c == '_' || c == '.' || c == '{' || c == '}'
+	}) {
+		id += strings.ToUpper(v[:1]) + v[1:]
+	}
+	return id
+}
+
+// formSchema describes the form fields of a binding.FieldMapper. Fields bound
+// from path parameters are left out.
+func formSchema(form binding.FieldMapper, params []schema) schema {
+	properties := schema{}
+	required := []string{}
+	for ptr, v := range form.FieldMap(nil) {
+		field, ok := v.(binding.Field)
+		if !ok {
+			field = binding.Field{Form: v.(string)}
+		}
+
+		skip := false
+		for _, p := range params {
+			if p["name"] == field.Form {
+				skip = true
+			}
+		}
+		if skip {
+			continue
+		}
+
+		properties[field.Form] = fieldSchema(reflect.TypeOf(ptr).Elem())
+		if field.Required {
+			required = append(required, field.Form)
+		}
+	}
+	sort.Strings(required)
+
+	result := schema{
+		"type":       "object",
+		"properties": properties,
+	}
+	if 0 < len(required) {
+		result["required"] = required
+	}
+	return result
+}
+
+// fieldSchema describes a form field. Binder types are repeated string
+// fields such as "KEY=VAL".
+func fieldSchema(t reflect.Type) schema {
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*binding.Binder)(nil)).Elem()) {
+		return schema{"type": "array", "items": schema{"type": "string"}}
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return schema{"type": "array", "items": fieldSchema(t.Elem())}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Float64:
+		return schema{"type": "number"}
+	default:
+		return schema{"type": "string"}
+	}
+}
+
+// schema describes the JSON encoding of t. Named structs are added to the
+// components and referenced.
+func (b *specBuilder) schema(t reflect.Type) schema {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return schema{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return schema{"type": "integer", "description": "nanoseconds"}
+	case reflect.TypeOf(http.Header{}):
+		return schema{"type": "object", "additionalProperties": schema{"type": "array", "items": schema{"type": "string"}}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": "string", "format": "byte"}
+		}
+		return schema{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Struct:
+		if t.Name() == "" || t.PkgPath() == reflect.TypeOf(b).Elem().PkgPath() {
+			return b.structSchema(t)
+		}
+		name := t.Name()
+		if other, ok := b.types[name]; ok && other != t {
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		if _, ok := b.types[name]; !ok {
+			b.types[name] = t
+			b.schemas[name] = b.structSchema(t)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	default:
+		return schema{}
+	}
+}
+
+func (b *specBuilder) structSchema(t reflect.Type) schema {
+	properties := schema{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		name := f.Name
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if v := strings.Split(tag, ",")[0]; v != "" {
+			name = v
+		}
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range b.structSchema(f.Type)["properties"].(schema) {
+				properties[k] = v
+			}
+			continue
+		}
+
+		properties[name] = b.schema(f.Type)
+	}
+
+	return schema{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func sortedKeys(m schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Apps) openAPI(w http.ResponseWriter, r *http.Request) {
+	a.render.JSON(w, http.StatusOK, a.spec)
+}
@@ -0,0 +1,77 @@
+package apps
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	a := &Apps{mux: http.NewServeMux()}
+	a.registerRoutes()
+
+	paths := a.spec["paths"].(schema)
+	documented := func(pattern, method string) bool {
+		item, ok := paths[pattern].(schema)
+		if !ok {
+			return false
+		}
+		_, ok = item[strings.ToLower(method)]
+		return ok
+	}
+
+	isDispatch := func(pattern string) bool {
+		for _, v := range dispatchPatterns {
+			if v == pattern {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Routes served by dispatch are documented and reachable through one
+	// of the dispatch patterns.
+	served := make(map[string]bool)
+	for _, v := range a.routes {
+		if !documented(v.pattern, v.method) {
+			t.Errorf("%s %s is not documented", v.method, v.pattern)
+		}
+
+		reachable := false
+		for _, p := range dispatchPatterns {
+			if v.pattern == p || strings.HasSuffix(p, "/") && strings.HasPrefix(v.pattern, p) {
+				served[p] = true
+				reachable = true
+			}
+		}
+		if !reachable {
+			t.Errorf("%s %s is not registered on the mux", v.method, v.pattern)
+		}
+	}
+
+	for _, p := range a.patterns {
+		switch {
+		case p == "/":
+			// static files
+		case isDispatch(p):
+			if !served[p] {
+				t.Errorf("dispatch pattern %s serves no documented route", p)
+			}
+		default:
+			item, ok := paths[p].(schema)
+			if !ok || len(item) == 0 {
+				t.Errorf("%s is registered but not documented", p)
+			}
+		}
+	}
+
+	for _, p := range append([]string{"/"}, dispatchPatterns...) {
+		found := false
+		for _, v := range a.patterns {
+			found = found || v == p
+		}
+		if !found {
+			t.Errorf("%s is not registered", p)
+		}
+	}
+}
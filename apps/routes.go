@@ -0,0 +1,80 @@
+package apps
+
+import (
+	"net/http"
+
+	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/accesslog"
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/capture"
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/maintenance"
+	"github.com/mix3/phantasma/metrics"
+	"github.com/mix3/phantasma/rproxy"
+)
+
+// route is a management API endpoint. The mux is registered from the same
+// routes that /api/openapi.json is generated from, so every endpoint is
+// documented.
+type route struct {
+	method  string
+	pattern string
+	summary string
+	legacy  bool
+	form    binding.FieldMapper
+	body    interface{}
+	status  int
+	result  interface{}
+	raw     string
+	upload  bool
+	handler func(http.ResponseWriter, *http.Request, map[string]string)
+}
+
+func handle(h http.HandlerFunc) func(http.ResponseWriter, *http.Request, map[string]string) {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		h(w, r)
+	}
+}
+
+// legacyRoutes are the original endpoints. They accept any method and
+// report errors with status 200 and the error text as result.
+func (a *Apps) legacyRoutes() []route {
+	routes := []route{
+		{method: "POST", pattern: "/api/launch", summary: "Launch an environment (with async=true, answer once the job is started)", form: new(forms.LaunchForm), result: "ok", handler: handle(a.launch)},
+		{method: "POST", pattern: "/api/terminate", summary: "Terminate an environment (with async=true, answer once the job is started)", form: new(forms.TerminateForm), result: "ok", handler: handle(a.terminate)},
+		{method: "POST", pattern: "/api/redeploy", summary: "Relaunch an environment with its current settings (with async=true, answer once the job is started)", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.redeploy)},
+		{method: "GET", pattern: "/api/image/list", summary: "List images", result: []apis.ImageInfo{}, handler: handle(a.imageList)},
+		{method: "GET", pattern: "/api/list", summary: "List environments", result: []apis.PodInfo{}, handler: handle(a.list)},
+		{method: "POST", pattern: "/api/split", summary: "Split traffic between variants", form: new(forms.SplitForm), result: "ok", handler: handle(a.split)},
+		{method: "POST", pattern: "/api/split/delete", summary: "Stop splitting traffic", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.splitDelete)},
+		{method: "POST", pattern: "/api/mirror", summary: "Mirror requests to another subdomain", form: new(forms.MirrorForm), result: "ok", handler: handle(a.mirror)},
+		{method: "POST", pattern: "/api/mirror/delete", summary: "Stop mirroring requests", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.mirrorDelete)},
+		{method: "POST", pattern: "/api/capture", summary: "Start capturing requests; Authorization, Cookie and Set-Cookie headers are redacted unless credentials=true", form: new(forms.CaptureForm), result: "ok", handler: handle(a.capture)},
+		{method: "POST", pattern: "/api/capture/delete", summary: "Stop capturing requests", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.captureDelete)},
+		{method: "GET", pattern: "/api/capture/list", summary: "List captured requests", form: new(forms.SubdomainForm), result: []capture.Capture{}, handler: handle(a.captureList)},
+		{method: "GET", pattern: "/api/capture/har", summary: "Export captured requests as HAR", form: new(forms.CaptureQueryForm), result: capture.HAR{}, raw: "application/json", handler: handle(a.captureHAR)},
+		{method: "POST", pattern: "/api/capture/replay", summary: "Replay a captured request without its redacted headers; the response body is cut at 1 MiB", form: new(forms.ReplayForm), result: rproxy.ReplayResult{}, handler: handle(a.captureReplay)},
+		{method: "POST", pattern: "/api/compress", summary: "Enable response compression", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.compress)},
+		{method: "POST", pattern: "/api/compress/delete", summary: "Disable response compression", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.compressDelete)},
+		{method: "POST", pattern: "/api/cache", summary: "Enable the response cache", form: new(forms.CacheForm), result: "ok", handler: handle(a.cache)},
+		{method: "POST", pattern: "/api/cache/delete", summary: "Disable the response cache", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.cacheDelete)},
+		{method: "POST", pattern: "/api/cache/purge", summary: "Purge the response cache", form: new(forms.SubdomainForm), result: "ok", handler: handle(a.cachePurge)},
+		{method: "POST", pattern: "/api/maintenance", summary: "Enable maintenance mode of subdomain, or of all subdomains with global=true", form: new(forms.MaintenanceForm), result: "ok", handler: handle(a.maintenance)},
+		{method: "POST", pattern: "/api/maintenance/delete", summary: "Disable maintenance mode of subdomain, or the global one with global=true", form: new(forms.MaintenanceForm), result: "ok", handler: handle(a.maintenanceDelete)},
+		{method: "GET", pattern: "/api/maintenance/list", summary: "Show maintenance mode", result: maintenance.State{}, handler: handle(a.maintenanceList)},
+		{method: "GET", pattern: "/api/access_log", summary: "List recent requests", form: new(forms.AccessLogForm), result: []accesslog.Entry{}, handler: handle(a.accessLogList)},
+	}
+	for i := range routes {
+		routes[i].legacy = true
+	}
+	return routes
+}
+
+func (a *Apps) miscRoutes() []route {
+	return []route{
+		{method: "GET", pattern: "/api/openapi.json", summary: "OpenAPI specification", raw: "application/json", handler: handle(a.openAPI)},
+		{method: "GET", pattern: "/api/info", summary: "Show rkt, appc and rkt api versions", result: apis.Info{}, handler: handle(a.info)},
+		{method: "GET", pattern: "/healthz", summary: "Report rkt and systemd connectivity (503 when unhealthy)", result: apis.Health{}, raw: "application/json", handler: handle(a.healthz)},
+		{method: "GET", pattern: "/metrics", summary: "Prometheus metrics", raw: "text/plain", handler: handle(metrics.Handler().ServeHTTP)},
+	}
+}
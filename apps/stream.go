@@ -0,0 +1,132 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/forms"
+)
+
+const keepAliveInterval = 30 * time.Second
+
+func (a *Apps) v1Logs(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	subdomain := params["subdomain"]
+
+	logsForm := new(forms.LogsForm)
+	if errs := binding.Bind(r, logsForm); 0 < errs.Len() {
+		a.renderError(w, errs)
+		return
+	}
+
+	info, ok, err := a.rp.Get(r.Context(), subdomain)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if !ok {
+		a.renderError(w, notFound(fmt.Errorf("environment not found: %s", subdomain)))
+		return
+	}
+	if !info.Running {
+		a.renderError(w, conflict(fmt.Errorf("environment not running: %s", subdomain)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, v := range info.Replicas {
+		prefix := ""
+		if 1 < len(info.Replicas) {
+			prefix = fmt.Sprintf("[%d] ", v.Replica)
+		}
+
+		wg.Add(1)
+		go func(uuid, prefix string) {
+			defer wg.Done()
+
+			err := a.api.Logs(r.Context(), uuid, logsForm.Lines, logsForm.Follow, func(line string) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if _, err := fmt.Fprintln(w, prefix+line); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+				return nil
+			})
+			if err != nil {
+				log.Println("[apps] logs", subdomain, err)
+			}
+		}(v.Uuid, prefix)
+	}
+	wg.Wait()
+}
+
+// v1Events streams events as server-sent events until the client goes away.
+func (a *Apps) v1Events(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	eventsForm := new(forms.EventsForm)
+	if errs := binding.Bind(r, eventsForm); 0 < errs.Len() {
+		a.renderError(w, errs)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		a.renderError(w, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch, cancel := a.events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if eventsForm.Subdomain != "" && e.Subdomain != eventsForm.Subdomain {
+				continue
+			}
+			if err := writeSSE(w, e.Type, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
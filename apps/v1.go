@@ -0,0 +1,351 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/binding"
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/events"
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/jobs"
+)
+
+func (a *Apps) v1Routes() []route {
+	return []route{
+		{
+			method:  "GET",
+			pattern: "/api/v1/environments",
+			summary: "List environments",
+			result:  []apis.PodInfo{},
+			handler: a.v1ListEnvironments,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/v1/environments/{subdomain}",
+			summary: "Get an environment",
+			result:  apis.PodInfo{},
+			handler: a.v1GetEnvironment,
+		},
+		{
+			method:  "PUT",
+			pattern: "/api/v1/environments/{subdomain}",
+			summary: "Launch or relaunch an environment (with async=true, answer 202 with the job)",
+			form:    new(forms.LaunchForm),
+			body:    forms.LaunchForm{},
+			status:  http.StatusCreated,
+			result:  apis.PodInfo{},
+			handler: a.v1PutEnvironment,
+		},
+		{
+			method:  "DELETE",
+			pattern: "/api/v1/environments/{subdomain}",
+			summary: "Terminate an environment (with async=true, answer 202 with the job)",
+			status:  http.StatusNoContent,
+			handler: a.v1DeleteEnvironment,
+		},
+		{
+			method:  "POST",
+			pattern: "/api/v1/environments/{subdomain}/redeploy",
+			summary: "Relaunch an environment with its current settings (with async=true, answer 202 with the job)",
+			result:  apis.PodInfo{},
+			handler: a.v1Redeploy,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/v1/environments/{subdomain}/logs",
+			summary: "Show the logs of an environment (streamed with follow)",
+			form:    new(forms.LogsForm),
+			raw:     "text/plain",
+			handler: a.v1Logs,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/v1/images",
+			summary: "List images",
+			result:  []apis.ImageInfo{},
+			handler: a.v1ListImages,
+		},
+		{
+			method:  "POST",
+			pattern: "/api/v1/images/fetch",
+			summary: "Fetch an image with rkt fetch (with async=true, answer 202 with the job)",
+			form:    new(forms.FetchForm),
+			body:    forms.FetchForm{},
+			status:  http.StatusCreated,
+			result:  apis.ImageInfo{},
+			handler: a.v1FetchImage,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/v1/images/{id}",
+			summary: "Get an image",
+			result:  apis.ImageInfo{},
+			handler: a.v1GetImage,
+		},
+		{
+			method:  "GET",
+			pattern: "/api/v1/events",
+			summary: "Stream environment events as server-sent events",
+			form:    new(forms.EventsForm),
+			result:  events.Event{},
+			raw:     "text/event-stream",
+			handler: a.v1Events,
+		},
+	}
+}
+
+// matchPattern matches path against a pattern whose {name} segments capture
+// a single path segment each.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ps) != len(ss) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, p := range ps {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if ss[i] == "" {
+				return nil, false
+			}
+			params[p[1:len(p)-1]] = ss[i]
+			continue
+		}
+		if p != ss[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// dispatch serves the routes matched by pattern: the /api/v1, job and image
+// upload endpoints.
+func (a *Apps) dispatch(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, v := range a.routes {
+		params, ok := matchPattern(v.pattern, r.URL.Path)
+		if !ok {
+			continue
+		}
+		if v.method == r.Method {
+			v.handler(w, r, params)
+			return
+		}
+		allowed = append(allowed, v.method)
+	}
+
+	if 0 < len(allowed) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		a.renderError(w, newAPIError(
+			http.StatusMethodNotAllowed,
+			"method_not_allowed",
+			fmt.Errorf("method not allowed: %s %s", r.Method, r.URL.Path),
+		))
+		return
+	}
+
+	a.renderError(w, notFound(fmt.Errorf("no such endpoint: %s", r.URL.Path)))
+}
+
+func (a *Apps) v1ListEnvironments(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	list, err := a.rp.List(r.Context())
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string][]apis.PodInfo{
+		"result": list,
+	})
+}
+
+func (a *Apps) v1GetEnvironment(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	info, ok, err := a.rp.Get(r.Context(), params["subdomain"])
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if !ok {
+		a.renderError(w, notFound(fmt.Errorf("environment not found: %s", params["subdomain"])))
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string]apis.PodInfo{
+		"result": info,
+	})
+}
+
+func (a *Apps) v1PutEnvironment(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	subdomain := params["subdomain"]
+
+	_, exists, err := a.rp.Get(r.Context(), subdomain)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	launchForm := a.newLaunchForm()
+	if errs := bindLaunchForm(r, launchForm, subdomain); 0 < errs.Len() {
+		a.renderError(w, errs)
+		return
+	}
+
+	job, err := a.startLaunch(jobs.Launch, launchForm)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if async(r) {
+		a.renderAccepted(w, job)
+		return
+	}
+	if err := a.waitJob(r, job); err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if exists {
+		status = http.StatusOK
+	}
+	a.renderEnvironment(w, r, status, subdomain)
+}
+
+func (a *Apps) v1Redeploy(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	subdomain := params["subdomain"]
+
+	job, err := a.startRedeploy(r.Context(), subdomain)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if async(r) {
+		a.renderAccepted(w, job)
+		return
+	}
+	if err := a.waitJob(r, job); err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.renderEnvironment(w, r, http.StatusOK, subdomain)
+}
+
+func (a *Apps) renderEnvironment(w http.ResponseWriter, r *http.Request, status int, subdomain string) {
+	info, _, err := a.rp.Get(r.Context(), subdomain)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.render.JSON(w, status, map[string]apis.PodInfo{
+		"result": info,
+	})
+}
+
+func (a *Apps) v1DeleteEnvironment(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	subdomain := params["subdomain"]
+
+	_, ok, err := a.rp.Get(r.Context(), subdomain)
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if !ok {
+		a.renderError(w, notFound(fmt.Errorf("environment not found: %s", subdomain)))
+		return
+	}
+
+	job := a.startTerminate(subdomain)
+	if async(r) {
+		a.renderAccepted(w, job)
+		return
+	}
+	if err := a.waitJob(r, job); err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Apps) v1ListImages(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	imageList, err := a.api.ImageList(r.Context())
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+	if imageList == nil {
+		imageList = []apis.ImageInfo{}
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string][]apis.ImageInfo{
+		"result": imageList,
+	})
+}
+
+func (a *Apps) v1GetImage(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	image, err := a.api.GetImage(r.Context(), params["id"])
+	if errors.Is(err, apis.ErrImageNotFound) {
+		a.renderError(w, notFound(err))
+		return
+	}
+	if err != nil {
+		a.renderError(w, err)
+		return
+	}
+
+	a.render.JSON(w, http.StatusOK, map[string]apis.ImageInfo{
+		"result": image,
+	})
+}
+
+func (a *Apps) v1FetchImage(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	fetchForm := new(forms.FetchForm)
+	if errs := binding.Bind(r, fetchForm); 0 < errs.Len() {
+		a.renderError(w, errs)
+		return
+	}
+
+	job := a.startFetch(fetchForm.Image, false, nil)
+	if async(r) {
+		a.renderAccepted(w, job)
+		return
+	}
+	a.renderFetched(w, r, job)
+}
+
+// bindLaunchForm binds a form or JSON body into launchForm, taking the
+// subdomain from the URL path instead of the body.
+func bindLaunchForm(r *http.Request, launchForm *forms.LaunchForm, subdomain string) binding.Errors {
+	if !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		r.ParseForm()
+		r.Form.Set("subdomain", subdomain)
+		return binding.Bind(r, launchForm)
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(launchForm); err != nil && err != io.EOF {
+		var errs binding.Errors
+		if errors.As(err, &errs) {
+			return errs
+		}
+		errs.Add([]string{}, binding.DeserializationError, err.Error())
+		return errs
+	}
+	launchForm.Subdomain = subdomain
+
+	return binding.Validate(r, launchForm)
+}
+
+func (a *Apps) renderError(w http.ResponseWriter, err error) {
+	e := toAPIError(err)
+	a.render.JSON(w, e.status, map[string]*apiError{
+		"error": e,
+	})
+}
@@ -0,0 +1,282 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config of a capture buffer. Credential headers are redacted unless
+// Credentials is set.
+type Config struct {
+	Size        int  `json:"size"`
+	MaxBody     int  `json:"max_body"`
+	Credentials bool `json:"credentials"`
+}
+
+// Redacted replaces the values of credential headers in captures.
+const Redacted = "[redacted]"
+
+var credentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+func redact(h http.Header) http.Header {
+	for _, k := range credentialHeaders {
+		if v, ok := h[k]; ok {
+			h[k] = make([]string, len(v))
+			for i := range v {
+				h[k][i] = Redacted
+			}
+		}
+	}
+	return h
+}
+
+type Capture struct {
+	Id                    string        `json:"id"`
+	Time                  time.Time     `json:"time"`
+	Subdomain             string        `json:"subdomain"`
+	Method                string        `json:"method"`
+	Host                  string        `json:"host"`
+	Path                  string        `json:"path"`
+	Proto                 string        `json:"proto"`
+	RequestHeader         http.Header   `json:"request_header"`
+	RequestBody           []byte        `json:"-"`
+	RequestBodyTruncated  bool          `json:"request_body_truncated"`
+	Status                int           `json:"status"`
+	ResponseHeader        http.Header   `json:"response_header"`
+	ResponseBody          []byte        `json:"-"`
+	ResponseBodyTruncated bool          `json:"response_body_truncated"`
+	Duration              time.Duration `json:"duration"`
+}
+
+type buffer struct {
+	config   Config
+	captures []*Capture
+	next     int
+}
+
+func (b *buffer) add(c *Capture) {
+	if len(b.captures) < b.config.Size {
+		b.captures = append(b.captures, c)
+		return
+	}
+	b.captures[b.next] = c
+	b.next = (b.next + 1) % len(b.captures)
+}
+
+// list returns captures oldest first.
+func (b *buffer) list() []*Capture {
+	result := make([]*Capture, 0, len(b.captures))
+	result = append(result, b.captures[b.next:]...)
+	result = append(result, b.captures[:b.next]...)
+	return result
+}
+
+type Store struct {
+	mu      sync.Mutex
+	seq     int
+	buffers map[string]*buffer
+}
+
+func New() *Store {
+	return &Store{
+		buffers: make(map[string]*buffer),
+	}
+}
+
+func (s *Store) Enable(subdomain string, config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buffers[subdomain]; ok && b.config == config {
+		return
+	}
+	s.buffers[subdomain] = &buffer{config: config}
+}
+
+func (s *Store) Disable(subdomain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buffers[subdomain]; !ok {
+		return fmt.Errorf("capture not enabled: %s", subdomain)
+	}
+	delete(s.buffers, subdomain)
+
+	return nil
+}
+
+func (s *Store) Config(subdomain string) (Config, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buffers[subdomain]
+	if !ok {
+		return Config{}, false
+	}
+	return b.config, true
+}
+
+func (s *Store) List(subdomain string) ([]*Capture, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buffers[subdomain]
+	if !ok {
+		return nil, fmt.Errorf("capture not enabled: %s", subdomain)
+	}
+	return b.list(), nil
+}
+
+func (s *Store) Get(subdomain, id string) (*Capture, error) {
+	list, err := s.List(subdomain)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range list {
+		if v.Id == id {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("capture not found: %s", id)
+}
+
+func (s *Store) add(subdomain string, c *Capture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buffers[subdomain]
+	if !ok {
+		return
+	}
+	s.seq++
+	c.Id = strconv.Itoa(s.seq)
+	b.add(c)
+}
+
+// Start begins recording r when capture is enabled for subdomain. The
+// returned writer must be used for the response and finish called once the
+// response is complete.
+func (s *Store) Start(w http.ResponseWriter, r *http.Request, subdomain string) (http.ResponseWriter, func()) {
+	config, ok := s.Config(subdomain)
+	if !ok {
+		return w, func() {}
+	}
+
+	c := &Capture{
+		Time:          time.Now(),
+		Subdomain:     subdomain,
+		Method:        r.Method,
+		Host:          r.Host,
+		Path:          r.URL.RequestURI(),
+		Proto:         r.Proto,
+		RequestHeader: cloneHeader(r.Header),
+	}
+
+	var reqBody *limitedBuffer
+	if r.Body != nil && r.Body != http.NoBody {
+		reqBody = &limitedBuffer{max: config.MaxBody}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, reqBody), r.Body}
+	}
+
+	rw := &responseWriter{
+		ResponseWriter: w,
+		body:           &limitedBuffer{max: config.MaxBody},
+	}
+
+	return rw, func() {
+		if reqBody != nil {
+			c.RequestBody = reqBody.buf
+			c.RequestBodyTruncated = reqBody.truncated
+		}
+		c.Status = rw.status
+		if c.Status == 0 {
+			c.Status = http.StatusOK
+		}
+		c.ResponseHeader = cloneHeader(rw.Header())
+		c.ResponseBody = rw.body.buf
+		c.ResponseBodyTruncated = rw.body.truncated
+		c.Duration = time.Since(c.Time)
+		if !config.Credentials {
+			redact(c.RequestHeader)
+			redact(c.ResponseHeader)
+		}
+
+		s.add(subdomain, c)
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	result := make(http.Header, len(h))
+	for k, v := range h {
+		result[k] = append([]string(nil), v...)
+	}
+	return result
+}
+
+type limitedBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	rest := lb.max - len(lb.buf)
+	if rest < len(p) {
+		lb.truncated = true
+		if 0 < rest {
+			lb.buf = append(lb.buf, p[:rest]...)
+		}
+		return len(p), nil
+	}
+	lb.buf = append(lb.buf, p...)
+	return len(p), nil
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	body   *limitedBuffer
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,47 @@
+package capture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		credentials bool
+		want        string
+	}{
+		{false, Redacted},
+		{true, "Bearer secret"},
+	}
+	for _, tt := range tests {
+		s := New()
+		s.Enable("app", Config{Size: 1, MaxBody: 16, Credentials: tt.credentials})
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("Accept", "text/html")
+		w, finish := s.Start(httptest.NewRecorder(), r, "app")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.WriteHeader(http.StatusOK)
+		finish()
+
+		list, err := s.List("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := list[0]
+		if got := c.RequestHeader.Get("Authorization"); got != tt.want {
+			t.Errorf("credentials %v: Authorization %q, want %q", tt.credentials, got, tt.want)
+		}
+		if got := c.ResponseHeader.Get("Set-Cookie"); (got == Redacted) == tt.credentials {
+			t.Errorf("credentials %v: Set-Cookie %q", tt.credentials, got)
+		}
+		if got := c.RequestHeader.Get("Accept"); got != "text/html" {
+			t.Errorf("Accept %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("request header changed to %q", got)
+		}
+	}
+}
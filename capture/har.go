@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func ToHAR(captures []*Capture) HAR {
+	entries := make([]HAREntry, 0, len(captures))
+	for _, c := range captures {
+		entries = append(entries, c.harEntry())
+	}
+
+	return HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{
+				Name:    "phantasma",
+				Version: "1",
+			},
+			Entries: entries,
+		},
+	}
+}
+
+func (c *Capture) harEntry() HAREntry {
+	ms := float64(c.Duration) / float64(time.Millisecond)
+
+	u := &url.URL{Scheme: "http", Host: c.Host}
+	if ref, err := url.Parse(c.Path); err == nil {
+		u = u.ResolveReference(ref)
+	}
+
+	req := HARRequest{
+		Method:      c.Method,
+		URL:         u.String(),
+		HTTPVersion: c.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(c.RequestHeader),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(c.RequestBody),
+	}
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			req.QueryString = append(req.QueryString, HARNameValue{k, v})
+		}
+	}
+	for _, v := range (&http.Request{Header: c.RequestHeader}).Cookies() {
+		req.Cookies = append(req.Cookies, HARNameValue{v.Name, v.Value})
+	}
+	if 0 < len(c.RequestBody) {
+		req.PostData = &HARPostData{
+			MimeType: c.RequestHeader.Get("Content-Type"),
+			Text:     string(c.RequestBody),
+		}
+	}
+
+	res := HARResponse{
+		Status:      c.Status,
+		StatusText:  http.StatusText(c.Status),
+		HTTPVersion: c.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(c.ResponseHeader),
+		Content: HARContent{
+			Size:     len(c.ResponseBody),
+			MimeType: c.ResponseHeader.Get("Content-Type"),
+		},
+		RedirectURL: c.ResponseHeader.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(c.ResponseBody),
+	}
+	for _, v := range (&http.Response{Header: c.ResponseHeader}).Cookies() {
+		res.Cookies = append(res.Cookies, HARNameValue{v.Name, v.Value})
+	}
+	if utf8.Valid(c.ResponseBody) {
+		res.Content.Text = string(c.ResponseBody)
+	} else {
+		res.Content.Text = base64.StdEncoding.EncodeToString(c.ResponseBody)
+		res.Content.Encoding = "base64"
+	}
+
+	entry := HAREntry{
+		StartedDateTime: c.Time.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         req,
+		Response:        res,
+		Timings: HARTimings{
+			Send:    0,
+			Wait:    ms,
+			Receive: 0,
+		},
+	}
+	if c.RequestBodyTruncated || c.ResponseBodyTruncated {
+		entry.Comment = fmt.Sprintf(
+			"body truncated: request %v, response %v",
+			c.RequestBodyTruncated,
+			c.ResponseBodyTruncated,
+		)
+	}
+
+	return entry
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	result := []HARNameValue{}
+	for k, vs := range h {
+		for _, v := range vs {
+			result = append(result, HARNameValue{k, v})
+		}
+	}
+	return result
+}
@@ -0,0 +1,313 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/events"
+	"github.com/mix3/phantasma/forms"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// Client talks to the /api/v1 endpoints of a phantasma server.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sends token as a bearer token, for servers behind an
+// authenticating proxy.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url: %s", baseURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+type FieldError struct {
+	Fields         []string `json:"fields"`
+	Classification string   `json:"classification"`
+	Message        string   `json:"message"`
+}
+
+// Error is an error response of the server.
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Fields     []FieldError `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) Launch(ctx context.Context, launchForm *forms.LaunchForm) (apis.PodInfo, error) {
+	var info apis.PodInfo
+	err := c.do(ctx, "PUT", "/api/v1/environments/"+url.PathEscape(launchForm.Subdomain), nil, launchForm, &info)
+	return info, err
+}
+
+// Redeploy relaunches subdomain on the server with the settings it runs
+// with.
+func (c *Client) Redeploy(ctx context.Context, subdomain string) (apis.PodInfo, error) {
+	var info apis.PodInfo
+	err := c.do(ctx, "POST", "/api/v1/environments/"+url.PathEscape(subdomain)+"/redeploy", nil, nil, &info)
+	return info, err
+}
+
+func (c *Client) Terminate(ctx context.Context, subdomain string) error {
+	return c.do(ctx, "DELETE", "/api/v1/environments/"+url.PathEscape(subdomain), nil, nil, nil)
+}
+
+func (c *Client) List(ctx context.Context) ([]apis.PodInfo, error) {
+	var list []apis.PodInfo
+	err := c.do(ctx, "GET", "/api/v1/environments", nil, nil, &list)
+	return list, err
+}
+
+func (c *Client) Get(ctx context.Context, subdomain string) (apis.PodInfo, error) {
+	var info apis.PodInfo
+	err := c.do(ctx, "GET", "/api/v1/environments/"+url.PathEscape(subdomain), nil, nil, &info)
+	return info, err
+}
+
+func (c *Client) Images(ctx context.Context) ([]apis.ImageInfo, error) {
+	var list []apis.ImageInfo
+	err := c.do(ctx, "GET", "/api/v1/images", nil, nil, &list)
+	return list, err
+}
+
+// Fetch fetches image into the rkt store of the server and returns it once
+// rkt is done.
+func (c *Client) Fetch(ctx context.Context, image string) (apis.ImageInfo, error) {
+	var info apis.ImageInfo
+	err := c.do(ctx, "POST", "/api/v1/images/fetch", nil, forms.FetchForm{Image: image}, &info)
+	return info, err
+}
+
+// Upload imports the image archive read from archive into the rkt store of
+// the server. The server rejects it unless it is size bytes long and, when
+// sha256 is not empty, has that hex digest.
+func (c *Client) Upload(ctx context.Context, archive io.Reader, size int64, sha256 string) (apis.ImageInfo, error) {
+	query := url.Values{}
+	query.Set("size", strconv.FormatInt(size, 10))
+	if sha256 != "" {
+		query.Set("sha256", sha256)
+	}
+
+	var info apis.ImageInfo
+	err := c.do(ctx, "POST", "/api/images", query, archive, &info)
+	return info, err
+}
+
+// Logs returns the log lines of subdomain. With follow the body streams
+// until ctx is done or it is closed.
+func (c *Client) Logs(ctx context.Context, subdomain string, lines int, follow bool) (io.ReadCloser, error) {
+	query := url.Values{}
+	if 0 < lines {
+		query.Set("lines", strconv.Itoa(lines))
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+
+	res, err := c.send(ctx, "GET", "/api/v1/environments/"+url.PathEscape(subdomain)+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Events streams events, of subdomain only unless it is empty. The channel
+// is closed when ctx is done or the connection ends.
+func (c *Client) Events(ctx context.Context, subdomain string) (<-chan events.Event, error) {
+	query := url.Values{}
+	if subdomain != "" {
+		query.Set("subdomain", subdomain)
+	}
+
+	res, err := c.send(ctx, "GET", "/api/v1/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan events.Event)
+	go func() {
+		defer close(ch)
+		defer res.Body.Close()
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			data := strings.TrimPrefix(scanner.Text(), "data: ")
+			if data == scanner.Text() {
+				continue
+			}
+
+			var e events.Event
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				continue
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// WaitUntilRunning polls subdomain every interval until it is running or
+// ctx is done.
+func (c *Client) WaitUntilRunning(ctx context.Context, subdomain string, interval time.Duration) (apis.PodInfo, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		info, err := c.Get(ctx, subdomain)
+		if err != nil && !IsNotFound(err) {
+			return info, err
+		}
+		if err == nil && info.Running {
+			return info, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return info, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	res, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if result == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+
+	v := struct {
+		Result interface{} `json:"result"`
+	}{result}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return fmt.Errorf("could not decode response: %v", err)
+	}
+	return nil
+}
+
+// send performs a request and turns error statuses into *Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var (
+		r           io.Reader
+		contentType string
+	)
+	switch v := body.(type) {
+	case nil:
+	case io.Reader:
+		r = v
+		contentType = "application/octet-stream"
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 400 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	e := &Error{StatusCode: res.StatusCode}
+	v := struct {
+		Error *Error `json:"error"`
+	}{e}
+	b, _ := ioutil.ReadAll(res.Body)
+	if err := json.Unmarshal(b, &v); err != nil || e.Message == "" {
+		e.Code = strings.ToLower(strings.Replace(http.StatusText(res.StatusCode), " ", "_", -1))
+		e.Message = strings.TrimSpace(string(b))
+		if e.Message == "" {
+			e.Message = http.StatusText(res.StatusCode)
+		}
+	}
+	return nil, e
+}
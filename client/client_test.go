@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/events"
+	"github.com/mix3/phantasma/forms"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL+"/", WithToken("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func writeResult(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": v})
+}
+
+func TestLaunch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/api/v1/environments/app" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization %q", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type %q", got)
+		}
+
+		var lf forms.LaunchForm
+		if err := json.NewDecoder(r.Body).Decode(&lf); err != nil {
+			t.Error(err)
+		}
+		writeResult(w, http.StatusCreated, apis.PodInfo{
+			Subdomain: lf.Subdomain,
+			Image:     lf.ImageName,
+			Running:   true,
+		})
+	})
+
+	info, err := c.Launch(context.Background(), &forms.LaunchForm{
+		Subdomain: "app",
+		ImageName: "example.com/app:v1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Subdomain != "app" || info.Image != "example.com/app:v1" || !info.Running {
+		t.Errorf("info %+v", info)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/api/v1/environments/app" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := c.Terminate(context.Background(), "app"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		code    string
+		message string
+		fields  int
+	}{
+		{
+			name:    "api error",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"error":{"code":"validation_failed","message":"invalid","fields":[{"fields":["port"],"classification":"RangeError","message":"bad port"}]}}`,
+			code:    "validation_failed",
+			message: "invalid",
+			fields:  1,
+		},
+		{
+			name:    "plain text",
+			status:  http.StatusBadGateway,
+			body:    "upstream down\n",
+			code:    "bad_gateway",
+			message: "upstream down",
+		},
+		{
+			name:    "empty",
+			status:  http.StatusNotFound,
+			code:    "not_found",
+			message: "Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			_, err := c.Get(context.Background(), "app")
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("err %v, want *Error", err)
+			}
+			if e.StatusCode != tt.status || e.Code != tt.code || e.Message != tt.message || len(e.Fields) != tt.fields {
+				t.Errorf("err %+v", e)
+			}
+			if IsNotFound(err) != (tt.status == http.StatusNotFound) {
+				t.Errorf("IsNotFound %v", IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("subdomain"); got != "app" {
+			t.Errorf("subdomain %q", got)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: launched\ndata: {\"type\":\"launched\",\"subdomain\":\"app\"}\n\n")
+		fmt.Fprint(w, "data: not json\n\n")
+		fmt.Fprint(w, "event: terminated\ndata: {\"type\":\"terminated\",\"subdomain\":\"app\"}\n\n")
+	})
+
+	ch, err := c.Events(context.Background(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []events.Event
+	for e := range ch {
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[0].Type != events.Launched || got[1].Type != events.Terminated || got[1].Subdomain != "app" {
+		t.Errorf("events %+v", got)
+	}
+}
+
+func TestWaitUntilRunning(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusNotFound)
+		case 2:
+			writeResult(w, http.StatusOK, apis.PodInfo{Subdomain: "app"})
+		default:
+			writeResult(w, http.StatusOK, apis.PodInfo{Subdomain: "app", Running: true})
+		}
+	})
+
+	info, err := c.WaitUntilRunning(context.Background(), "app", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Running || calls != 3 {
+		t.Errorf("info %+v after %d calls", info, calls)
+	}
+}
+
+func TestWaitUntilRunningCanceled(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, http.StatusOK, apis.PodInfo{Subdomain: "app"})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.WaitUntilRunning(ctx, "app", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRedeploy(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/environments/app/redeploy" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		writeResult(w, http.StatusOK, apis.PodInfo{Subdomain: "app", Running: true})
+	})
+
+	info, err := c.Redeploy(context.Background(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Subdomain != "app" || !info.Running {
+		t.Errorf("info %+v", info)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/client"
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/options"
+)
+
+func init() {
+	parser.AddCommand("launch", "Launch an environment", "Launch or relaunch an environment from an image.", &launchCommand{})
+	parser.AddCommand("terminate", "Terminate environments", "Terminate environments.", &terminateCommand{})
+	parser.AddCommand("ls", "List environments", "List environments.", &lsCommand{})
+	parser.AddCommand("images", "List images", "List images.", &imagesCommand{})
+	parser.AddCommand("fetch", "Fetch an image", "Fetch an appc image or a docker:// URL into the rkt store of the server.", &fetchCommand{})
+	parser.AddCommand("upload", "Upload an image archive", "Upload an image archive such as an ACI file and import it into the rkt store of the server.", &uploadCommand{})
+	parser.AddCommand("logs", "Show the logs of an environment", "Show the logs of an environment.", &logsCommand{})
+	parser.AddCommand("restart", "Restart an environment", "Relaunch an environment with its current settings.", &restartCommand{})
+	parser.AddCommand("exec", "Run a command in an environment", "Run a command in a pod of an environment with rkt enter. Must run on the rkt host.", &execCommand{})
+}
+
+type waitOptions struct {
+	Wait    bool          `long:"wait" description:"wait until the environment is running"`
+	Timeout time.Duration `long:"timeout" default:"5m" description:"how long to wait"`
+}
+
+// localOptions read pods and images from rkt on this host instead of from
+// the server.
+type localOptions struct {
+	Local       bool   `long:"local" description:"ask rkt on this host instead of the server"`
+	ApiEndpoint string `long:"api-endpoint" default:"localhost:15441" description:"rkt api endpoint"`
+	Specific    string `long:"specific" default:"phantasma" description:"specific for prefix, suffix"`
+}
+
+func (o localOptions) api() (*apis.Api, error) {
+	return apis.New(options.Options{
+		ApiEndpoint: o.ApiEndpoint,
+		Specific:    o.Specific,
+	})
+}
+
+type launchCommand struct {
+	ImageId  string   `long:"image-id" description:"image id instead of the image name"`
+	Port     int      `long:"port" description:"port the app listens on"`
+	Net      string   `long:"net" description:"rkt net"`
+	Env      []string `short:"e" long:"env" description:"KEY=VAL environment variable"`
+	Alias    []string `long:"alias" description:"alias hostname"`
+	PortMap  []string `long:"port-map" description:"name=port routed to <name>.<subdomain>"`
+	TCP      []string `long:"tcp" description:"[host:]pod tcp forward"`
+	Replicas int      `long:"replicas" description:"number of pods"`
+	LB       string   `long:"lb" description:"load balancing between replicas"`
+	Limits   string   `long:"limits" description:"rate=,burst=,ip_rate=,ip_burst=,max_conns= (0 takes the default, -1 disables)"`
+	waitOptions
+	Args struct {
+		Subdomain string `positional-arg-name:"subdomain" required:"true"`
+		Image     string `positional-arg-name:"image"`
+	} `positional-args:"yes"`
+}
+
+func (c *launchCommand) Execute(args []string) error {
+	if c.ImageId == "" && c.Args.Image == "" {
+		return fmt.Errorf("image or --image-id is required")
+	}
+
+	launchForm := &forms.LaunchForm{
+		ImageId:   c.ImageId,
+		ImageName: c.Args.Image,
+		Subdomain: c.Args.Subdomain,
+		Port:      c.Port,
+		Net:       c.Net,
+		Aliases:   c.Alias,
+		Replicas:  c.Replicas,
+		LB:        c.LB,
+		Limits:    forms.ParseLimits(c.Limits),
+	}
+	errs := launchForm.Envs.Bind("env", c.Env, nil)
+	errs = launchForm.PortMaps.Bind("port-map", c.PortMap, errs)
+	errs = launchForm.TCPForwards.Bind("tcp", c.TCP, errs)
+	if 0 < errs.Len() {
+		return errs
+	}
+
+	return launch(launchForm, c.waitOptions)
+}
+
+func launch(launchForm *forms.LaunchForm, wait waitOptions) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	info, err := cli.Launch(ctx, launchForm)
+	if err != nil {
+		return err
+	}
+
+	return printLaunched(ctx, cli, info, wait)
+}
+
+// printLaunched prints a launched environment, once it runs when asked to
+// wait.
+func printLaunched(ctx context.Context, cli *client.Client, info apis.PodInfo, wait waitOptions) error {
+	if wait.Wait && !info.Running {
+		ctx, cancel := context.WithTimeout(ctx, wait.Timeout)
+		defer cancel()
+
+		var err error
+		if info, err = cli.WaitUntilRunning(ctx, info.Subdomain, 0); err != nil {
+			return err
+		}
+	}
+
+	return printEnvironments([]apis.PodInfo{info})
+}
+
+type terminateCommand struct {
+	Args struct {
+		Subdomains []string `positional-arg-name:"subdomain" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func (c *terminateCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	for _, v := range c.Args.Subdomains {
+		if err := cli.Terminate(ctx, v); err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+		fmt.Println(v)
+	}
+	return nil
+}
+
+type lsCommand struct {
+	localOptions
+}
+
+func (c *lsCommand) Execute(args []string) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var list []apis.PodInfo
+	if c.Local {
+		api, err := c.api()
+		if err != nil {
+			return err
+		}
+		defer api.Close()
+
+		m, err := api.PodInfoMap(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range m {
+			list = append(list, v)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Subdomain < list[j].Subdomain
+		})
+	} else {
+		cli, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		if list, err = cli.List(ctx); err != nil {
+			return err
+		}
+	}
+	if list == nil {
+		list = []apis.PodInfo{}
+	}
+
+	return printEnvironments(list)
+}
+
+func printEnvironments(list []apis.PodInfo) error {
+	return output(list, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "SUBDOMAIN\tIMAGE\tRUNNING\tREPLICAS\tHOST\tALIASES")
+		for _, v := range list {
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%t\t%d/%d\t%s\t%s\n",
+				v.Subdomain,
+				v.Image,
+				v.Running,
+				len(v.Replicas),
+				v.ReplicaSize,
+				v.Host,
+				strings.Join(v.Aliases, ","),
+			)
+		}
+	})
+}
+
+type imagesCommand struct {
+	localOptions
+}
+
+func (c *imagesCommand) Execute(args []string) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var list []apis.ImageInfo
+	if c.Local {
+		api, err := c.api()
+		if err != nil {
+			return err
+		}
+		defer api.Close()
+
+		if list, err = api.ImageList(ctx); err != nil {
+			return err
+		}
+	} else {
+		cli, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		if list, err = cli.Images(ctx); err != nil {
+			return err
+		}
+	}
+	if list == nil {
+		list = []apis.ImageInfo{}
+	}
+
+	return output(list, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tVERSION")
+		for _, v := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Id, v.Name, v.Version)
+		}
+	})
+}
+
+type fetchCommand struct {
+	Args struct {
+		Image string `positional-arg-name:"image" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (c *fetchCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	image, err := cli.Fetch(ctx, c.Args.Image)
+	if err != nil {
+		return err
+	}
+
+	return printImage(image)
+}
+
+func printImage(image apis.ImageInfo) error {
+	return output(image, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tVERSION")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Id, image.Name, image.Version)
+	})
+}
+
+type uploadCommand struct {
+	Args struct {
+		File string `positional-arg-name:"file" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (c *uploadCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(c.Args.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The digest is taken first so that the server can check what it got.
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	image, err := cli.Upload(ctx, f, size, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+
+	return printImage(image)
+}
+
+type logsCommand struct {
+	Lines  int  `short:"n" long:"lines" description:"number of recent lines"`
+	Follow bool `short:"f" long:"follow" description:"keep streaming new lines"`
+	Args   struct {
+		Subdomain string `positional-arg-name:"subdomain" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (c *logsCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	body, err := cli.Logs(ctx, c.Args.Subdomain, c.Lines, c.Follow)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(os.Stdout, body); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+type restartCommand struct {
+	waitOptions
+	Args struct {
+		Subdomain string `positional-arg-name:"subdomain" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (c *restartCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	info, err := cli.Redeploy(ctx, c.Args.Subdomain)
+	if err != nil {
+		return err
+	}
+
+	return printLaunched(ctx, cli, info, c.waitOptions)
+}
+
+type execCommand struct {
+	Replica int    `long:"replica" description:"replica to enter"`
+	Rkt     string `long:"rkt" default:"/usr/local/bin/rkt" description:"rkt command path"`
+	Args    struct {
+		Subdomain string   `positional-arg-name:"subdomain" required:"true"`
+		Command   []string `positional-arg-name:"command"`
+	} `positional-args:"yes"`
+}
+
+func (c *execCommand) Execute(args []string) error {
+	cli, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	info, err := cli.Get(ctx, c.Args.Subdomain)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	uuid := ""
+	for _, v := range info.Replicas {
+		if v.Replica == c.Replica {
+			uuid = v.Uuid
+		}
+	}
+	if uuid == "" {
+		return fmt.Errorf("replica %d of %s not running", c.Replica, c.Args.Subdomain)
+	}
+
+	cmd := exec.Command(c.Rkt, append([]string{"enter", uuid}, c.Args.Command...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			os.Exit(e.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package errorpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mix3/phantasma/options"
+)
+
+const (
+	NotFound      = "not_found"
+	Stopped       = "stopped"
+	Starting      = "starting"
+	UpstreamError = "upstream_error"
+	Maintenance   = "maintenance"
+)
+
+type Page struct {
+	Name       string `json:"code"`
+	Status     int    `json:"status"`
+	Title      string `json:"title"`
+	Message    string `json:"message"`
+	Subdomain  string `json:"subdomain,omitempty"`
+	StartURL   string `json:"start_url,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+	Home       string `json:"-"`
+}
+
+type Pages struct {
+	templates map[string]*template.Template
+	opts      options.Options
+}
+
+// New parses the built-in templates, replacing each one with
+// <static-dir>/errors/<name>.html when that file exists.
+func New(opts options.Options) (*Pages, error) {
+	p := &Pages{
+		templates: make(map[string]*template.Template),
+		opts:      opts,
+	}
+
+	for name, text := range defaultTemplates {
+		path := filepath.Join(opts.StaticDir, "errors", name+".html")
+		if b, err := ioutil.ReadFile(path); err == nil {
+			log.Println("[errorpage] override", name, "with", path)
+			text = string(b)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		p.templates[name] = tmpl
+	}
+
+	return p, nil
+}
+
+func (p *Pages) NotFound(w http.ResponseWriter, r *http.Request, subdomain string) {
+	message := "There is no environment named " + subdomain + "."
+	if subdomain == "" {
+		message = "No environment was specified."
+	}
+	p.Render(w, r, Page{
+		Name:      NotFound,
+		Status:    http.StatusNotFound,
+		Title:     "Environment not found",
+		Message:   message,
+		Subdomain: subdomain,
+	})
+}
+
+func (p *Pages) Stopped(w http.ResponseWriter, r *http.Request, subdomain string) {
+	p.Render(w, r, Page{
+		Name:      Stopped,
+		Status:    http.StatusServiceUnavailable,
+		Title:     "Environment stopped",
+		Message:   "The environment " + subdomain + " is not running.",
+		Subdomain: subdomain,
+		StartURL:  p.baseURL(r) + "/launcher/?subdomain=" + url.QueryEscape(subdomain),
+	})
+}
+
+func (p *Pages) Starting(w http.ResponseWriter, r *http.Request, subdomain string) {
+	p.Render(w, r, Page{
+		Name:       Starting,
+		Status:     http.StatusServiceUnavailable,
+		Title:      "Environment starting",
+		Message:    "The environment " + subdomain + " is starting up. This page reloads automatically.",
+		Subdomain:  subdomain,
+		RetryAfter: 5,
+	})
+}
+
+func (p *Pages) UpstreamError(w http.ResponseWriter, r *http.Request, subdomain string, status int, message string) {
+	p.Render(w, r, Page{
+		Name:      UpstreamError,
+		Status:    status,
+		Title:     http.StatusText(status),
+		Message:   message,
+		Subdomain: subdomain,
+	})
+}
+
+func (p *Pages) Maintenance(w http.ResponseWriter, r *http.Request, subdomain, message string, retryAfter int) {
+	if message == "" {
+		message = "The environment " + subdomain + " is under maintenance."
+	}
+	p.Render(w, r, Page{
+		Name:       Maintenance,
+		Status:     http.StatusServiceUnavailable,
+		Title:      "Under maintenance",
+		Message:    message,
+		Subdomain:  subdomain,
+		RetryAfter: retryAfter,
+	})
+}
+
+// Render writes page as JSON or HTML depending on the Accept header.
+func (p *Pages) Render(w http.ResponseWriter, r *http.Request, page Page) {
+	if 0 < page.RetryAfter {
+		w.Header().Set("Retry-After", strconv.Itoa(page.RetryAfter))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	page.Home = p.baseURL(r) + "/"
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(page.Status)
+		json.NewEncoder(w).Encode(map[string]Page{
+			"error": page,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := p.templates[page.Name].Execute(&buf, page); err != nil {
+		log.Printf("[errorpage] render %s: %v", page.Name, err)
+		http.Error(w, page.Message, page.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(page.Status)
+	buf.WriteTo(w)
+}
+
+// baseURL is the scheme-relative URL of the phantasma UI, keeping the port
+// the request came in on.
+func (p *Pages) baseURL(r *http.Request) string {
+	host := p.opts.Domain
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		host = net.JoinHostPort(host, port)
+	}
+	return "//" + host
+}
+
+// wantsJSON reports whether the client prefers JSON over HTML.
+func wantsJSON(r *http.Request) bool {
+	htmlQ, jsonQ := -1.0, -1.0
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		switch {
+		case mediaType == "text/html" && htmlQ < q:
+			htmlQ = q
+		case (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && jsonQ < q:
+			jsonQ = q
+		}
+	}
+	return htmlQ < jsonQ
+}
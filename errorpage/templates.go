@@ -0,0 +1,43 @@
+package errorpage
+
+const layoutHead = `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    {{if .RetryAfter}}<meta http-equiv="refresh" content="{{.RetryAfter}}">{{end}}
+    <title>{{.Title}} - phantasma</title>
+    <link rel="stylesheet" href="//maxcdn.bootstrapcdn.com/bootstrap/3.3.6/css/bootstrap.min.css">
+    <style type="text/css">
+    body {
+      padding-top: 60px;
+    }
+    </style>
+  </head>
+  <body>
+    <div class="container" role="main">
+      <div class="page-header">
+        <h1>{{.Title}} <small>{{.Status}}</small></h1>
+      </div>
+      <p class="lead">{{.Message}}</p>
+`
+
+const layoutFoot = `    </div>
+  </body>
+</html>
+`
+
+var defaultTemplates = map[string]string{
+	NotFound: layoutHead + `      <p>Check the hostname, or see the <a href="{{.Home}}">list of environments</a>.</p>
+` + layoutFoot,
+	Stopped: layoutHead + `      <p><a class="btn btn-primary" href="{{.StartURL}}">Start it</a></p>
+` + layoutFoot,
+	Starting: layoutHead + `      <div class="progress">
+        <div class="progress-bar progress-bar-striped active" style="width: 100%"></div>
+      </div>
+` + layoutFoot,
+	Maintenance: layoutHead + `      <p>Please try again later.</p>
+` + layoutFoot,
+	UpstreamError: layoutHead + `      <p>The environment {{.Subdomain}} did not respond properly. Try again later.</p>
+` + layoutFoot,
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	Launched            = "launched"
+	Terminated          = "terminated"
+	MaintenanceEnabled  = "maintenance_enabled"
+	MaintenanceDisabled = "maintenance_disabled"
+	ImageFetched        = "image_fetched"
+)
+
+const subscriberBuffer = 64
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Subdomain string    `json:"subdomain,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Bus fans events out to subscribers. Slow subscribers miss events rather
+// than blocking publishers.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func New() *Bus {
+	return &Bus{
+		subs: make(map[chan Event]struct{}),
+	}
+}
+
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events published from now on. cancel must
+// be called to release it.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
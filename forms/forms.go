@@ -1,9 +1,11 @@
 package forms
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/binding"
@@ -21,6 +23,7 @@ func (e *Envs) Bind(fieldName string, strVals []string, errs binding.Errors) bin
 		kv := strings.Split(v, "=")
 		if len(kv) != 2 {
 			errs.Add([]string{fieldName}, "EnvParseError", fmt.Sprintf("cannot parse Env for: %v", v))
+			continue
 		}
 		*e = append(*e, Env{
 			Key: kv[0],
@@ -30,6 +33,20 @@ func (e *Envs) Bind(fieldName string, strVals []string, errs binding.Errors) bin
 	return errs
 }
 
+// UnmarshalJSON accepts "KEY=VAL" strings as well as objects.
+func (e *Envs) UnmarshalJSON(b []byte) error {
+	var strVals []string
+	if err := json.Unmarshal(b, &strVals); err == nil {
+		return bindError(e.Bind("env", strVals, nil))
+	}
+	var envs []Env
+	if err := json.Unmarshal(b, &envs); err != nil {
+		return err
+	}
+	*e = envs
+	return nil
+}
+
 func (e Envs) OptionString() string {
 	var opts []string
 	for _, v := range e {
@@ -38,15 +55,244 @@ func (e Envs) OptionString() string {
 	return strings.Join(opts, " ")
 }
 
-var subdomainMatcher = regexp.MustCompile("^[a-zA-Z0-9-.]+$")
+type PortMap struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type PortMaps []PortMap
+
+func (p *PortMaps) Bind(fieldName string, strVals []string, errs binding.Errors) binding.Errors {
+	for _, v := range strVals {
+		kv := strings.Split(v, "=")
+		if len(kv) != 2 {
+			errs.Add([]string{fieldName}, "PortMapParseError", fmt.Sprintf("cannot parse PortMap for: %v", v))
+			continue
+		}
+		port, ok := parsePort(kv[1])
+		if !ok {
+			errs.Add([]string{fieldName}, "PortMapParseError", fmt.Sprintf("cannot parse PortMap for: %v", v))
+			continue
+		}
+		*p = append(*p, PortMap{
+			Name: kv[0],
+			Port: port,
+		})
+	}
+	return errs
+}
+
+// UnmarshalJSON accepts "name=port" strings as well as objects.
+func (p *PortMaps) UnmarshalJSON(b []byte) error {
+	var strVals []string
+	if err := json.Unmarshal(b, &strVals); err == nil {
+		return bindError(p.Bind("port_map", strVals, nil))
+	}
+	var portMaps []PortMap
+	if err := json.Unmarshal(b, &portMaps); err != nil {
+		return err
+	}
+	*p = portMaps
+	return nil
+}
+
+func (p PortMaps) String() string {
+	var maps []string
+	for _, v := range p {
+		maps = append(maps, fmt.Sprintf("%s=%d", v.Name, v.Port))
+	}
+	return strings.Join(maps, ",")
+}
+
+func (p PortMaps) Get(name string) (int, bool) {
+	for _, v := range p {
+		if v.Name == name {
+			return v.Port, true
+		}
+	}
+	return 0, false
+}
+
+type TCPForward struct {
+	HostPort int `json:"host_port"`
+	PodPort  int `json:"pod_port"`
+}
+
+type TCPForwards []TCPForward
+
+func parsePort(s string) (int, bool) {
+	port, err := strconv.Atoi(s)
+	if err != nil || !validPort(port) {
+		return 0, false
+	}
+	return port, true
+}
+
+func validPort(port int) bool {
+	return 0 < port && port <= 65535
+}
+
+func (t *TCPForwards) Bind(fieldName string, strVals []string, errs binding.Errors) binding.Errors {
+	for _, v := range strVals {
+		var (
+			hostPort = 0
+			podPort  = 0
+			ok       = false
+		)
+		ports := strings.Split(v, ":")
+		switch len(ports) {
+		case 1:
+			podPort, ok = parsePort(ports[0])
+		case 2:
+			if hostPort, ok = parsePort(ports[0]); ok {
+				podPort, ok = parsePort(ports[1])
+			}
+		}
+		if !ok {
+			errs.Add([]string{fieldName}, "TCPForwardParseError", fmt.Sprintf("cannot parse TCPForward for: %v", v))
+			continue
+		}
+		*t = append(*t, TCPForward{
+			HostPort: hostPort,
+			PodPort:  podPort,
+		})
+	}
+	return errs
+}
+
+// UnmarshalJSON accepts "[host:]pod" strings as well as objects.
+func (t *TCPForwards) UnmarshalJSON(b []byte) error {
+	var strVals []string
+	if err := json.Unmarshal(b, &strVals); err == nil {
+		return bindError(t.Bind("tcp", strVals, nil))
+	}
+	var forwards []TCPForward
+	if err := json.Unmarshal(b, &forwards); err != nil {
+		return err
+	}
+	*t = forwards
+	return nil
+}
+
+func (t TCPForwards) String() string {
+	var forwards []string
+	for _, v := range t {
+		forwards = append(forwards, fmt.Sprintf("%d:%d", v.HostPort, v.PodPort))
+	}
+	return strings.Join(forwards, ",")
+}
+
+func bindError(errs binding.Errors) error {
+	if 0 < errs.Len() {
+		return errs
+	}
+	return nil
+}
+
+type Variant struct {
+	Subdomain string `json:"subdomain"`
+	Weight    int    `json:"weight"`
+}
+
+type Variants []Variant
+
+func (v *Variants) Bind(fieldName string, strVals []string, errs binding.Errors) binding.Errors {
+	for _, val := range strVals {
+		kv := strings.Split(val, "=")
+		if len(kv) != 2 {
+			errs.Add([]string{fieldName}, "VariantParseError", fmt.Sprintf("cannot parse Variant for: %v", val))
+			continue
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			errs.Add([]string{fieldName}, "VariantParseError", fmt.Sprintf("cannot parse Variant for: %v", val))
+			continue
+		}
+		*v = append(*v, Variant{
+			Subdomain: kv[0],
+			Weight:    weight,
+		})
+	}
+	return errs
+}
+
+// NoLimit turns a rate or connection limit off for one environment, where
+// 0 takes the default of the command line.
+const NoLimit = -1
+
+func validLimit(v float64) bool {
+	return v == NoLimit || 0 <= v
+}
+
+// Limits of an environment. Zero values take the defaults, NoLimit disables
+// the rate, ip_rate and max_conns limits.
+type Limits struct {
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	IPRate   float64 `json:"ip_rate"`
+	IPBurst  int     `json:"ip_burst"`
+	MaxConns int     `json:"max_conns"`
+}
+
+func (l Limits) String() string {
+	return fmt.Sprintf(
+		"rate=%g,burst=%d,ip_rate=%g,ip_burst=%d,max_conns=%d",
+		l.Rate,
+		l.Burst,
+		l.IPRate,
+		l.IPBurst,
+		l.MaxConns,
+	)
+}
+
+func ParseLimits(s string) Limits {
+	var l Limits
+	for _, v := range strings.Split(s, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "rate":
+			l.Rate, _ = strconv.ParseFloat(kv[1], 64)
+		case "burst":
+			l.Burst, _ = strconv.Atoi(kv[1])
+		case "ip_rate":
+			l.IPRate, _ = strconv.ParseFloat(kv[1], 64)
+		case "ip_burst":
+			l.IPBurst, _ = strconv.Atoi(kv[1])
+		case "max_conns":
+			l.MaxConns, _ = strconv.Atoi(kv[1])
+		}
+	}
+	return l
+}
+
+const (
+	LBRoundRobin = "round-robin"
+	LBLeastConn  = "least-conn"
+	LBSticky     = "sticky"
+)
+
+var subdomainMatcher = regexp.MustCompile("^[a-zA-Z0-9-]+(\\.[a-zA-Z0-9-]+)*$")
+
+var portNameMatcher = regexp.MustCompile("^[a-zA-Z0-9-]+$")
+
+var hostMatcher = regexp.MustCompile("^[a-zA-Z0-9-]+(\\.[a-zA-Z0-9-]+)*$")
 
 type LaunchForm struct {
-	ImageId   string
-	ImageName string
-	Subdomain string
-	Port      int
-	Net       string
-	Envs      Envs
+	ImageId     string      `json:"image_id,omitempty"`
+	ImageName   string      `json:"image_name,omitempty"`
+	Subdomain   string      `json:"subdomain"`
+	Port        int         `json:"port"`
+	Net         string      `json:"net,omitempty"`
+	Envs        Envs        `json:"env"`
+	Aliases     []string    `json:"alias"`
+	PortMaps    PortMaps    `json:"port_map"`
+	TCPForwards TCPForwards `json:"tcp"`
+	Replicas    int         `json:"replicas"`
+	LB          string      `json:"lb,omitempty"`
+	Limits      Limits      `json:"limits"`
 }
 
 func (lf *LaunchForm) FieldMap(r *http.Request) binding.FieldMap {
@@ -70,6 +316,36 @@ func (lf *LaunchForm) FieldMap(r *http.Request) binding.FieldMap {
 		&lf.Envs: binding.Field{
 			Form: "env",
 		},
+		&lf.Aliases: binding.Field{
+			Form: "alias",
+		},
+		&lf.PortMaps: binding.Field{
+			Form: "port_map",
+		},
+		&lf.TCPForwards: binding.Field{
+			Form: "tcp",
+		},
+		&lf.Replicas: binding.Field{
+			Form: "replicas",
+		},
+		&lf.LB: binding.Field{
+			Form: "lb",
+		},
+		&lf.Limits.Rate: binding.Field{
+			Form: "rate_limit",
+		},
+		&lf.Limits.Burst: binding.Field{
+			Form: "rate_burst",
+		},
+		&lf.Limits.IPRate: binding.Field{
+			Form: "ip_rate_limit",
+		},
+		&lf.Limits.IPBurst: binding.Field{
+			Form: "ip_rate_burst",
+		},
+		&lf.Limits.MaxConns: binding.Field{
+			Form: "max_conns",
+		},
 	}
 }
 
@@ -81,13 +357,90 @@ func (lf LaunchForm) Validate(r *http.Request, errs binding.Errors) binding.Erro
 			Message:        "require image_id or image_name",
 		})
 	}
-	if !subdomainMatcher.MatchString(lf.Subdomain) {
+	errs = validateSubdomain(lf.Subdomain, errs)
+	if lf.Replicas < 0 {
 		errs = append(errs, binding.Error{
-			FieldNames:     []string{"subdomain"},
-			Classification: "RegExpError",
-			Message:        "subdomain is not good",
+			FieldNames:     []string{"replicas"},
+			Classification: "RangeError",
+			Message:        "replicas must be positive",
+		})
+	}
+	if !validLimit(lf.Limits.Rate) || !validLimit(lf.Limits.IPRate) || !validLimit(float64(lf.Limits.MaxConns)) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"rate_limit", "ip_rate_limit", "max_conns"},
+			Classification: "RangeError",
+			Message:        "limits must be positive, or -1 to disable them",
+		})
+	}
+	if lf.Limits.Burst < 0 || lf.Limits.IPBurst < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"rate_burst", "ip_rate_burst"},
+			Classification: "RangeError",
+			Message:        "bursts must be positive",
 		})
 	}
+	switch lf.LB {
+	case "", LBRoundRobin, LBLeastConn, LBSticky:
+	default:
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"lb"},
+			Classification: "ChoiceError",
+			Message:        fmt.Sprintf("lb must be one of %s, %s, %s", LBRoundRobin, LBLeastConn, LBSticky),
+		})
+	}
+	// JSON objects skip Bind, so their values are checked here as well.
+	for _, v := range lf.Envs {
+		if v.Key == "" || strings.Contains(v.Key, "=") {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"env"},
+				Classification: "EnvParseError",
+				Message:        fmt.Sprintf("env key is not good: %q", v.Key),
+			})
+		}
+	}
+	seen := make(map[string]bool)
+	for _, v := range lf.PortMaps {
+		if !validPort(v.Port) {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"port_map"},
+				Classification: "RangeError",
+				Message:        fmt.Sprintf("port of %s must be between 1 and 65535", v.Name),
+			})
+		}
+		if !portNameMatcher.MatchString(v.Name) {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"port_map"},
+				Classification: "RegExpError",
+				Message:        fmt.Sprintf("port name is not good: %s", v.Name),
+			})
+		}
+		if seen[v.Name] {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"port_map"},
+				Classification: "DuplicateError",
+				Message:        fmt.Sprintf("port name duplicated: %s", v.Name),
+			})
+		}
+		seen[v.Name] = true
+	}
+	for _, v := range lf.TCPForwards {
+		if !validPort(v.PodPort) || v.HostPort != 0 && !validPort(v.HostPort) {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"tcp"},
+				Classification: "RangeError",
+				Message:        fmt.Sprintf("tcp ports must be between 1 and 65535: %d:%d", v.HostPort, v.PodPort),
+			})
+		}
+	}
+	for _, v := range lf.Aliases {
+		if !hostMatcher.MatchString(v) {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"alias"},
+				Classification: "RegExpError",
+				Message:        fmt.Sprintf("alias is not good: %s", v),
+			})
+		}
+	}
 	return errs
 }
 
@@ -103,3 +456,481 @@ func (tf *TerminateForm) FieldMap(r *http.Request) binding.FieldMap {
 		},
 	}
 }
+
+func (tf TerminateForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	return validateSubdomain(tf.Subdomain, errs)
+}
+
+type SubdomainForm struct {
+	Subdomain string
+}
+
+func (sf *SubdomainForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&sf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+	}
+}
+
+func (sf SubdomainForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	return validateSubdomain(sf.Subdomain, errs)
+}
+
+// validateSubdomain rejects subdomains that are not dot separated labels, as
+// they also name files and directories.
+func validateSubdomain(subdomain string, errs binding.Errors) binding.Errors {
+	if !subdomainMatcher.MatchString(subdomain) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"subdomain"},
+			Classification: "RegExpError",
+			Message:        "subdomain is not good",
+		})
+	}
+	return errs
+}
+
+type AccessLogForm struct {
+	Subdomain string
+	Limit     int
+}
+
+func (af *AccessLogForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&af.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&af.Limit: binding.Field{
+			Form: "limit",
+		},
+	}
+}
+
+type LogsForm struct {
+	Lines  int
+	Follow bool
+}
+
+func (lf *LogsForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&lf.Lines: binding.Field{
+			Form: "lines",
+		},
+		&lf.Follow: binding.Field{
+			Form: "follow",
+		},
+	}
+}
+
+func (lf LogsForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if lf.Lines < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"lines"},
+			Classification: "RangeError",
+			Message:        "lines must be positive",
+		})
+	}
+	return errs
+}
+
+type EventsForm struct {
+	Subdomain string
+}
+
+func (ef *EventsForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&ef.Subdomain: binding.Field{
+			Form: "subdomain",
+		},
+	}
+}
+
+var imageNameMatcher = regexp.MustCompile("^[a-z0-9][a-z0-9._/-]*(:[a-zA-Z0-9._-]+)?$")
+
+type FetchForm struct {
+	Image string `json:"image"`
+}
+
+func (ff *FetchForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&ff.Image: binding.Field{
+			Form:     "image",
+			Required: true,
+		},
+	}
+}
+
+// Validate accepts appc image names and docker://, http:// and https:// URLs.
+func (ff FetchForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	for _, v := range []string{"docker://", "http://", "https://"} {
+		if strings.HasPrefix(ff.Image, v) && len(v) < len(ff.Image) {
+			return errs
+		}
+	}
+	if !imageNameMatcher.MatchString(ff.Image) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"image"},
+			Classification: "FormatError",
+			Message:        "image must be an appc image name or a docker://, http:// or https:// URL",
+		})
+	}
+	return errs
+}
+
+var (
+	sha256Matcher = regexp.MustCompile("^[0-9a-f]{64}$")
+	sha512Matcher = regexp.MustCompile("^[0-9a-f]{128}$")
+)
+
+// UploadForm holds what an uploaded archive is checked against. It is bound
+// from the query, as the body is the archive itself.
+type UploadForm struct {
+	Size   int64
+	SHA256 string
+	SHA512 string
+}
+
+func (uf *UploadForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&uf.Size: binding.Field{
+			Form: "size",
+		},
+		&uf.SHA256: binding.Field{
+			Form: "sha256",
+		},
+		&uf.SHA512: binding.Field{
+			Form: "sha512",
+		},
+	}
+}
+
+func (uf UploadForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if uf.Size < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"size"},
+			Classification: "RangeError",
+			Message:        "size must be positive",
+		})
+	}
+	if uf.SHA256 != "" && !sha256Matcher.MatchString(uf.SHA256) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"sha256"},
+			Classification: "FormatError",
+			Message:        "sha256 must be 64 lowercase hex digits",
+		})
+	}
+	if uf.SHA512 != "" && !sha512Matcher.MatchString(uf.SHA512) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"sha512"},
+			Classification: "FormatError",
+			Message:        "sha512 must be 128 lowercase hex digits",
+		})
+	}
+	return errs
+}
+
+type SplitForm struct {
+	Subdomain string
+	Variants  Variants
+}
+
+func (sf *SplitForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&sf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&sf.Variants: binding.Field{
+			Form:     "variant",
+			Required: true,
+		},
+	}
+}
+
+func (sf SplitForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if len(sf.Variants) < 2 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"variant"},
+			Classification: "RangeError",
+			Message:        "require at least two variants",
+		})
+	}
+	total := 0
+	seen := make(map[string]bool)
+	for _, v := range sf.Variants {
+		if !subdomainMatcher.MatchString(v.Subdomain) {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"variant"},
+				Classification: "RegExpError",
+				Message:        fmt.Sprintf("variant subdomain is not good: %s", v.Subdomain),
+			})
+		}
+		if seen[v.Subdomain] {
+			errs = append(errs, binding.Error{
+				FieldNames:     []string{"variant"},
+				Classification: "DuplicateError",
+				Message:        fmt.Sprintf("variant duplicated: %s", v.Subdomain),
+			})
+		}
+		seen[v.Subdomain] = true
+		total += v.Weight
+	}
+	if total <= 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"variant"},
+			Classification: "RangeError",
+			Message:        "sum of variant weights must be positive",
+		})
+	}
+	return errs
+}
+
+type Mirror struct {
+	Target  string  `json:"target"`
+	Rate    float64 `json:"rate"`
+	MaxBody int     `json:"max_body"`
+}
+
+type MirrorForm struct {
+	Subdomain string
+	Target    string
+	Rate      float64
+	MaxBody   int
+}
+
+func (mf *MirrorForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&mf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&mf.Target: binding.Field{
+			Form:     "target",
+			Required: true,
+		},
+		&mf.Rate: binding.Field{
+			Form: "rate",
+		},
+		&mf.MaxBody: binding.Field{
+			Form: "max_body",
+		},
+	}
+}
+
+func (mf MirrorForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if !subdomainMatcher.MatchString(mf.Target) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"target"},
+			Classification: "RegExpError",
+			Message:        "target is not good",
+		})
+	}
+	if mf.Target == mf.Subdomain {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"target"},
+			Classification: "RangeError",
+			Message:        "target must differ from subdomain",
+		})
+	}
+	if mf.Rate < 0 || 1 < mf.Rate {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"rate"},
+			Classification: "RangeError",
+			Message:        "rate must be between 0 and 1",
+		})
+	}
+	if mf.MaxBody < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"max_body"},
+			Classification: "RangeError",
+			Message:        "max_body must be positive",
+		})
+	}
+	return errs
+}
+
+type CaptureForm struct {
+	Subdomain   string
+	Size        int
+	MaxBody     int
+	Credentials bool
+}
+
+func (cf *CaptureForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&cf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&cf.Size: binding.Field{
+			Form: "size",
+		},
+		&cf.MaxBody: binding.Field{
+			Form: "max_body",
+		},
+		&cf.Credentials: binding.Field{
+			Form: "credentials",
+		},
+	}
+}
+
+func (cf CaptureForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if cf.Size <= 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"size"},
+			Classification: "RangeError",
+			Message:        "size must be positive",
+		})
+	}
+	if cf.MaxBody < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"max_body"},
+			Classification: "RangeError",
+			Message:        "max_body must be positive",
+		})
+	}
+	return errs
+}
+
+type CaptureQueryForm struct {
+	Subdomain string
+	Id        string
+}
+
+func (cf *CaptureQueryForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&cf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&cf.Id: binding.Field{
+			Form: "id",
+		},
+	}
+}
+
+type ReplayForm struct {
+	Subdomain string
+	Id        string
+	Target    string
+}
+
+func (rf *ReplayForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&rf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&rf.Id: binding.Field{
+			Form:     "id",
+			Required: true,
+		},
+		&rf.Target: binding.Field{
+			Form: "target",
+		},
+	}
+}
+
+func (rf ReplayForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if rf.Target != "" && !subdomainMatcher.MatchString(rf.Target) {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"target"},
+			Classification: "RegExpError",
+			Message:        "target is not good",
+		})
+	}
+	return errs
+}
+
+type CacheForm struct {
+	Subdomain string
+	MaxSize   int
+	MaxEntry  int
+	Disk      bool
+}
+
+func (cf *CacheForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&cf.Subdomain: binding.Field{
+			Form:     "subdomain",
+			Required: true,
+		},
+		&cf.MaxSize: binding.Field{
+			Form: "max_size",
+		},
+		&cf.MaxEntry: binding.Field{
+			Form: "max_entry",
+		},
+		&cf.Disk: binding.Field{
+			Form: "disk",
+		},
+	}
+}
+
+func (cf CacheForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	errs = validateSubdomain(cf.Subdomain, errs)
+	if cf.MaxSize <= 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"max_size"},
+			Classification: "RangeError",
+			Message:        "max_size must be positive",
+		})
+	}
+	if cf.MaxEntry <= 0 || cf.MaxSize < cf.MaxEntry {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"max_entry"},
+			Classification: "RangeError",
+			Message:        "max_entry must be positive and at most max_size",
+		})
+	}
+	return errs
+}
+
+// MaintenanceForm targets one subdomain, or every one with global=true, so
+// that a forgotten subdomain does not take all environments down.
+type MaintenanceForm struct {
+	Subdomain  string
+	Global     bool
+	Message    string
+	RetryAfter int
+}
+
+func (mf *MaintenanceForm) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&mf.Subdomain: binding.Field{
+			Form: "subdomain",
+		},
+		&mf.Global: binding.Field{
+			Form: "global",
+		},
+		&mf.Message: binding.Field{
+			Form: "message",
+		},
+		&mf.RetryAfter: binding.Field{
+			Form: "retry_after",
+		},
+	}
+}
+
+func (mf MaintenanceForm) Validate(r *http.Request, errs binding.Errors) binding.Errors {
+	if (mf.Subdomain == "") == !mf.Global {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"subdomain", "global"},
+			Classification: binding.RequiredError,
+			Message:        "require either subdomain or global=true",
+		})
+	}
+	if mf.Subdomain != "" {
+		errs = validateSubdomain(mf.Subdomain, errs)
+	}
+	if mf.RetryAfter < 0 {
+		errs = append(errs, binding.Error{
+			FieldNames:     []string{"retry_after"},
+			Classification: "RangeError",
+			Message:        "retry_after must be positive",
+		})
+	}
+	return errs
+}
@@ -0,0 +1,104 @@
+package forms
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLaunchFormValidateJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"strings", `{"env":["A=1"],"port_map":["http=80"],"tcp":["2222:22"]}`, true},
+		{"objects", `{"env":[{"key":"A","val":"a=b"}],"port_map":[{"name":"http","port":80}],"tcp":[{"pod_port":22}]}`, true},
+		{"empty env key", `{"env":[{"key":"","val":"1"}]}`, false},
+		{"env key with =", `{"env":[{"key":"A=B","val":"1"}]}`, false},
+		{"port map out of range", `{"port_map":[{"name":"http","port":70000}]}`, false},
+		{"port map without port", `{"port_map":[{"name":"http"}]}`, false},
+		{"tcp without pod port", `{"tcp":[{"host_port":2222}]}`, false},
+		{"tcp negative host port", `{"tcp":[{"host_port":-1,"pod_port":22}]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := LaunchForm{ImageName: "example.com/app:v1", Subdomain: "app"}
+			if err := json.Unmarshal([]byte(tt.body), &lf); err != nil {
+				t.Fatal(err)
+			}
+			errs := lf.Validate(nil, nil)
+			if ok := errs.Len() == 0; ok != tt.ok {
+				t.Errorf("errs %v, want ok %v", errs, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMaintenanceFormValidate(t *testing.T) {
+	tests := []struct {
+		form MaintenanceForm
+		ok   bool
+	}{
+		{MaintenanceForm{Subdomain: "app"}, true},
+		{MaintenanceForm{Global: true}, true},
+		{MaintenanceForm{}, false},
+		{MaintenanceForm{Subdomain: "app", Global: true}, false},
+	}
+	for _, tt := range tests {
+		errs := tt.form.Validate(nil, nil)
+		if ok := errs.Len() == 0; ok != tt.ok {
+			t.Errorf("%+v: errs %v, want ok %v", tt.form, errs, tt.ok)
+		}
+	}
+}
+
+func TestLaunchFormValidateLimits(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		ok     bool
+	}{
+		{Limits{}, true},
+		{Limits{Rate: NoLimit, IPRate: NoLimit, MaxConns: NoLimit}, true},
+		{Limits{Rate: -2}, false},
+		{Limits{Rate: -0.5}, false},
+		{Limits{IPRate: -1.5}, false},
+		{Limits{MaxConns: -2}, false},
+		{Limits{Burst: NoLimit}, false},
+	}
+	for _, tt := range tests {
+		lf := LaunchForm{ImageName: "example.com/app:v1", Subdomain: "app", Limits: tt.limits}
+		errs := lf.Validate(nil, nil)
+		if ok := errs.Len() == 0; ok != tt.ok {
+			t.Errorf("%+v: errs %v, want ok %v", tt.limits, errs, tt.ok)
+		}
+	}
+}
+
+func TestValidateSubdomain(t *testing.T) {
+	tests := []struct {
+		subdomain string
+		ok        bool
+	}{
+		{"app", true},
+		{"api.app", true},
+		{"feature-1", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../../..", false},
+		{"app..x", false},
+		{".app", false},
+		{"app.", false},
+		{"a/b", false},
+	}
+	for _, tt := range tests {
+		errs := SubdomainForm{Subdomain: tt.subdomain}.Validate(nil, nil)
+		if ok := errs.Len() == 0; ok != tt.ok {
+			t.Errorf("%q: errs %v, want ok %v", tt.subdomain, errs, tt.ok)
+		}
+		errs = CacheForm{Subdomain: tt.subdomain, MaxSize: 2, MaxEntry: 1}.Validate(nil, nil)
+		if ok := errs.Len() == 0; ok != tt.ok {
+			t.Errorf("cache %q: errs %v, want ok %v", tt.subdomain, errs, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package httpcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheHeader = "X-Phantasma-Cache"
+
+type Config struct {
+	MaxSize  int64 `json:"max_size"`
+	MaxEntry int64 `json:"max_entry"`
+	Disk     bool  `json:"disk"`
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("max_size=%d,max_entry=%d,disk=%v", c.MaxSize, c.MaxEntry, c.Disk)
+}
+
+type Stats struct {
+	Config
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+type entry struct {
+	key     string
+	status  int
+	header  http.Header
+	vary    map[string]string
+	body    []byte
+	size    int64
+	stored  time.Time
+	expires time.Time
+}
+
+// Cache is a shared HTTP cache for one subdomain. Bodies are kept in memory,
+// or in files under dir when the cache is on disk.
+type Cache struct {
+	mu      sync.Mutex
+	config  Config
+	root    string
+	dir     string
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+	hits    int64
+	misses  int64
+}
+
+// New returns a cache kept in memory, or on disk in the directory name under
+// root.
+func New(config Config, root, name string) (*Cache, error) {
+	dir := filepath.Join(root, name)
+	if config.Disk {
+		if !inside(root, dir) {
+			return nil, fmt.Errorf("cache dir %s is not in %s", dir, root)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{
+		config:  config,
+		root:    root,
+		dir:     dir,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}, nil
+}
+
+func (c *Cache) Config() Config {
+	return c.config
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Config:  c.config,
+		Entries: len(c.entries),
+		Size:    c.size,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// Purge drops every entry and removes the files of a disk cache.
+func (c *Cache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+
+	if c.config.Disk {
+		if !inside(c.root, c.dir) {
+			return fmt.Errorf("cache dir %s is not in %s", c.dir, c.root)
+		}
+		return os.RemoveAll(c.dir)
+	}
+	return nil
+}
+
+// inside reports whether dir is a directory below root.
+func inside(root, dir string) bool {
+	if root == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Serve answers r from the cache when a fresh entry exists, and otherwise
+// calls next and stores the response when it is cacheable.
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	if r.Method != "GET" && r.Method != "HEAD" || r.Header.Get("Authorization") != "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, ok := reqCC["no-store"]; ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if _, ok := reqCC["no-cache"]; !ok {
+		if e, body, ok := c.lookup(key, r); ok {
+			serveEntry(w, r, e, body)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+
+	w.Header().Set(cacheHeader, "MISS")
+	if r.Method == "HEAD" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, max: c.config.MaxEntry}
+	next.ServeHTTP(rec, r)
+
+	if e, ok := newEntry(key, r, rec); ok {
+		c.store(e)
+	}
+}
+
+func (c *Cache) lookup(key string, r *http.Request) (*entry, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, nil, false
+	}
+	for k, v := range e.vary {
+		if r.Header.Get(k) != v {
+			return nil, nil, false
+		}
+	}
+
+	body := e.body
+	if c.config.Disk {
+		b, err := ioutil.ReadFile(c.path(key))
+		if err != nil {
+			c.remove(el)
+			return nil, nil, false
+		}
+		body = b
+	}
+
+	c.lru.MoveToFront(el)
+	c.hits++
+
+	return e, body, true
+}
+
+func (c *Cache) store(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config.MaxSize < e.size {
+		return
+	}
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+
+	if c.config.Disk {
+		if err := ioutil.WriteFile(c.path(e.key), e.body, 0644); err != nil {
+			return
+		}
+		e.body = nil
+	}
+
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+
+	for c.config.MaxSize < c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if c.config.Disk {
+		os.Remove(c.path(e.key))
+	}
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func serveEntry(w http.ResponseWriter, r *http.Request, e *entry, body []byte) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	h.Set(cacheHeader, "HIT")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	w.WriteHeader(e.status)
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
+
+func newEntry(key string, r *http.Request, rec *recorder) (*entry, bool) {
+	header := rec.header
+	if rec.status != http.StatusOK || rec.overflow || header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	for _, v := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[v]; ok {
+			return nil, false
+		}
+	}
+
+	now := time.Now()
+	var ttl time.Duration
+	if v, ok := cc["s-maxage"]; ok {
+		n, _ := strconv.Atoi(v)
+		ttl = time.Duration(n) * time.Second
+	} else if v, ok := cc["max-age"]; ok {
+		n, _ := strconv.Atoi(v)
+		ttl = time.Duration(n) * time.Second
+	} else if v := header.Get("Expires"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			ttl = t.Sub(now)
+		}
+	}
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	vary := make(map[string]string)
+	for _, v := range strings.Split(header.Get("Vary"), ",") {
+		name := http.CanonicalHeaderKey(strings.TrimSpace(v))
+		if name == "*" {
+			return nil, false
+		}
+		if name != "" {
+			vary[name] = r.Header.Get(name)
+		}
+	}
+
+	stored := make(http.Header, len(header))
+	for k, v := range header {
+		if k == cacheHeader {
+			continue
+		}
+		stored[k] = append([]string(nil), v...)
+	}
+
+	return &entry{
+		key:     key,
+		status:  rec.status,
+		header:  stored,
+		vary:    vary,
+		body:    rec.body,
+		size:    int64(len(rec.body)),
+		stored:  now,
+		expires: now.Add(ttl),
+	}, true
+}
+
+func parseCacheControl(v string) map[string]string {
+	result := make(map[string]string)
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		kv := strings.SplitN(d, "=", 2)
+		k := strings.ToLower(kv[0])
+		if len(kv) == 2 {
+			result[k] = strings.Trim(kv[1], `"`)
+		} else {
+			result[k] = ""
+		}
+	}
+	return result
+}
+
+// recorder keeps the response as next wrote it. Its header is copied before
+// the writers it wraps, such as compression, add their own.
+type recorder struct {
+	http.ResponseWriter
+	max      int64
+	status   int
+	header   http.Header
+	body     []byte
+	overflow bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = rec.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+		rec.header = rec.Header().Clone()
+	}
+	if !rec.overflow {
+		if rec.max < int64(len(rec.body)+len(b)) {
+			rec.overflow = true
+			rec.body = nil
+		} else {
+			rec.body = append(rec.body, b...)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,42 @@
+package httpcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCacheStaysInRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "cache")
+	config := Config{MaxSize: 1 << 20, MaxEntry: 1 << 20, Disk: true}
+
+	for _, name := range []string{"", ".", "..", "../outside", "a/../.."} {
+		if _, err := New(config, root, name); err == nil {
+			t.Errorf("%q: cache created outside of %s", name, root)
+		}
+	}
+	if _, err := New(config, "", "app"); err == nil {
+		t.Error("disk cache created without a root")
+	}
+
+	c, err := New(config, root, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "app")); !os.IsNotExist(err) {
+		t.Errorf("cache dir not purged: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+}
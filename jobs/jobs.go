@@ -0,0 +1,365 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Launch    = "launch"
+	Terminate = "terminate"
+	Redeploy  = "redeploy"
+	Fetch     = "fetch"
+)
+
+const (
+	Queued            = "queued"
+	WritingUnit       = "writing_unit"
+	Starting          = "starting"
+	WaitingForRunning = "waiting_for_running"
+	Stopping          = "stopping"
+	Converting        = "converting"
+	Fetching          = "fetching"
+	Ready             = "ready"
+	Failed            = "failed"
+)
+
+const (
+	subscriberBuffer = 64
+	maxOutput        = 1000
+)
+
+type Transition struct {
+	State string    `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+type Job struct {
+	Id        string       `json:"id"`
+	Kind      string       `json:"kind"`
+	Subdomain string       `json:"subdomain"`
+	State     string       `json:"state"`
+	Error     string       `json:"error,omitempty"`
+	Created   time.Time    `json:"created"`
+	Updated   time.Time    `json:"updated"`
+	History   []Transition `json:"history"`
+	Output    []string     `json:"output,omitempty"`
+	Image     string       `json:"image,omitempty"`
+	lines     int
+	partial   []byte
+	err       error
+}
+
+// Err returns the error a failed job ended with.
+func (j Job) Err() error {
+	return j.err
+}
+
+func (j Job) Done() bool {
+	return j.State == Ready || j.State == Failed
+}
+
+// Lines returns the output lines written since the first n, as far as they
+// are still kept, and the number of lines written so far.
+func (j Job) Lines(n int) ([]string, int) {
+	if j.lines-n < len(j.Output) {
+		return j.Output[len(j.Output)-(j.lines-n):], j.lines
+	}
+	return j.Output, j.lines
+}
+
+// Func does the work of a job, reporting each state it enters to progress.
+type Func func(ctx context.Context, progress func(state string)) error
+
+// Manager runs jobs in the background, one at a time per subdomain, and
+// keeps the most recent ones.
+type Manager struct {
+	mu      sync.Mutex
+	seq     int
+	history int
+	jobs    map[string]*Job
+	order   []string
+	locks   map[string]chan struct{}
+	subs    map[chan Job]struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func New(history int) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		history: history,
+		jobs:    make(map[string]*Job),
+		locks:   make(map[string]chan struct{}),
+		subs:    make(map[chan Job]struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Close cancels running jobs.
+func (m *Manager) Close() {
+	m.cancel()
+}
+
+func (m *Manager) Start(kind, subdomain string, fn Func) Job {
+	return m.StartWithCleanup(kind, subdomain, fn, nil)
+}
+
+// StartWithCleanup is Start with cleanup, if any, called once the job is
+// over, also when it is canceled before its turn.
+func (m *Manager) StartWithCleanup(kind, subdomain string, fn Func, cleanup func()) Job {
+	m.mu.Lock()
+	m.seq++
+	now := time.Now()
+	j := &Job{
+		Id:        strconv.Itoa(m.seq),
+		Kind:      kind,
+		Subdomain: subdomain,
+		State:     Queued,
+		Created:   now,
+		Updated:   now,
+		History:   []Transition{{State: Queued, Time: now}},
+	}
+	m.jobs[j.Id] = j
+	m.order = append(m.order, j.Id)
+	m.prune()
+	lock, ok := m.locks[subdomain]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		m.locks[subdomain] = lock
+	}
+	result := m.snapshot(j)
+	m.publish(result)
+	m.mu.Unlock()
+
+	log.Printf("[jobs] %s %s %s", j.Id, kind, subdomain)
+
+	go m.run(j, lock, fn, cleanup)
+
+	return result
+}
+
+func (m *Manager) run(j *Job, lock chan struct{}, fn Func, cleanup func()) {
+	if cleanup == nil {
+		cleanup = func() {}
+	}
+
+	select {
+	case lock <- struct{}{}:
+	case <-m.ctx.Done():
+		cleanup()
+		m.finish(j, m.ctx.Err())
+		return
+	}
+	defer func() { <-lock }()
+
+	ctx := context.WithValue(m.ctx, runKey{}, &runner{m: m, j: j})
+	err := fn(ctx, func(state string) {
+		m.update(j, state, nil)
+	})
+	cleanup()
+	m.finish(j, err)
+}
+
+func (m *Manager) finish(j *Job, err error) {
+	m.mu.Lock()
+	if 0 < len(j.partial) {
+		m.appendLine(j, string(j.partial))
+		j.partial = nil
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("[jobs] %s failed: %v", j.Id, err)
+		m.update(j, Failed, err)
+		return
+	}
+	m.update(j, Ready, nil)
+}
+
+func (m *Manager) update(j *Job, state string, err error) {
+	m.mu.Lock()
+	now := time.Now()
+	j.State = state
+	if err != nil {
+		j.Error = err.Error()
+		j.err = err
+	}
+	j.Updated = now
+	j.History = append(j.History, Transition{State: state, Time: now})
+	m.publish(m.snapshot(j))
+	m.mu.Unlock()
+}
+
+// appendLine must be called with mu held.
+func (m *Manager) appendLine(j *Job, line string) {
+	j.Output = append(j.Output, line)
+	if maxOutput < len(j.Output) {
+		j.Output = j.Output[len(j.Output)-maxOutput:]
+	}
+	j.lines++
+}
+
+// prune drops the oldest finished jobs beyond the history size.
+func (m *Manager) prune() {
+	for i := 0; m.history < len(m.order) && i < len(m.order); {
+		id := m.order[i]
+		if !m.jobs[id].Done() {
+			i++
+			continue
+		}
+		delete(m.jobs, id)
+		m.order = append(m.order[:i], m.order[i+1:]...)
+	}
+}
+
+func (m *Manager) snapshot(j *Job) Job {
+	result := *j
+	result.History = append([]Transition{}, j.History...)
+	result.Output = append([]string(nil), j.Output...)
+	result.partial = nil
+	return result
+}
+
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job not found: %s", id)
+	}
+	return m.snapshot(j), nil
+}
+
+// List returns the jobs, newest first.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Job, 0, len(m.order))
+	for i := len(m.order) - 1; 0 <= i; i-- {
+		result = append(result, m.snapshot(m.jobs[m.order[i]]))
+	}
+	return result
+}
+
+// Wait blocks until job id is done or ctx is done.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	ch, cancel := m.Subscribe()
+	defer cancel()
+
+	j, err := m.Get(id)
+	if err != nil || j.Done() {
+		return j, err
+	}
+
+	// Updates may be dropped, so the job is also checked periodically.
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-ch:
+		case <-ticker.C:
+		}
+
+		if j, err = m.Get(id); err != nil || j.Done() {
+			return j, err
+		}
+	}
+}
+
+// publish must be called with mu held, so updates are seen in order.
+func (m *Manager) publish(j Job) {
+	for ch := range m.subs {
+		select {
+		case ch <- j:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of job updates. cancel must be called to
+// release it.
+func (m *Manager) Subscribe() (<-chan Job, func()) {
+	ch := make(chan Job, subscriberBuffer)
+
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if _, ok := m.subs[ch]; ok {
+			delete(m.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+type runKey struct{}
+
+type runner struct {
+	m *Manager
+	j *Job
+}
+
+// Write records complete lines of p as output of the job.
+func (r *runner) Write(p []byte) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	lines := r.j.lines
+	buf := append(r.j.partial, p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		r.m.appendLine(r.j, strings.TrimRight(string(buf[:i]), "\r"))
+		buf = buf[i+1:]
+	}
+	r.j.partial = append([]byte(nil), buf...)
+	if r.j.lines != lines {
+		r.j.Updated = time.Now()
+		r.m.publish(r.m.snapshot(r.j))
+	}
+
+	return len(p), nil
+}
+
+// Output returns a writer whose lines become the output of the job run with
+// ctx. Outside of a job it discards what is written.
+func Output(ctx context.Context) io.Writer {
+	if r, ok := ctx.Value(runKey{}).(*runner); ok {
+		return r
+	}
+	return ioutil.Discard
+}
+
+// SetImage records the image a job produced.
+func SetImage(ctx context.Context, id string) {
+	r, ok := ctx.Value(runKey{}).(*runner)
+	if !ok {
+		return
+	}
+
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.j.Image = id
+}
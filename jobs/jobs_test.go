@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCleanup(t *testing.T) {
+	m := New(10)
+
+	cleaned := make(chan string, 2)
+
+	// The first job holds the subdomain until the second one is over, so
+	// that one is canceled before its turn.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := m.StartWithCleanup(Fetch, "", func(ctx context.Context, progress func(string)) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}, func() { cleaned <- "first" })
+	<-started
+
+	second := m.StartWithCleanup(Fetch, "", func(ctx context.Context, progress func(string)) error {
+		t.Error("canceled job ran")
+		return nil
+	}, func() { cleaned <- "second" })
+
+	m.Close()
+
+	job, err := m.Wait(context.Background(), second.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if job.State != Failed {
+		t.Errorf("second job %s", job.State)
+	}
+	if job, err = m.Wait(context.Background(), first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if job.State != Failed {
+		t.Errorf("first job %s", job.State)
+	}
+
+	got := map[string]bool{<-cleaned: true, <-cleaned: true}
+	if !got["first"] || !got["second"] {
+		t.Errorf("cleaned up %v", got)
+	}
+}
@@ -1,46 +1,113 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mix3/phantasma/apis"
 	"github.com/mix3/phantasma/apps"
+	"github.com/mix3/phantasma/client"
 	"github.com/mix3/phantasma/options"
 )
 
-var opts options.Options
+type globalOptions struct {
+	Server string `long:"server" env:"PHANTASMA_SERVER" description:"phantasma server url, e.g. http://<domain>:5000"`
+	Token  string `long:"token" env:"PHANTASMA_TOKEN" description:"bearer token sent to the server"`
+	Format string `long:"format" default:"table" choice:"table" choice:"json" description:"output format"`
+}
 
-var parser = flags.NewParser(&opts, flags.Default)
+var global globalOptions
 
-func init() {
-	_, err := parser.Parse()
-	if err != nil {
-		if e, ok := err.(*flags.Error); ok && e.Type != flags.ErrHelp {
-			parser.ParseArgs([]string{"--help"})
-		}
-		os.Exit(1)
-	}
+var parser = flags.NewParser(&global, flags.Default)
+
+type serveCommand struct {
+	options.Options
 }
 
-func main() {
-	api, err := apis.New(opts)
+func (c *serveCommand) Execute(args []string) error {
+	api, err := apis.New(c.Options)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer api.Close()
 
-	app, err := apps.New(api, opts)
+	app, err := apps.New(api, c.Options)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer app.Close()
 
-	addr := fmt.Sprintf("%s:%d", opts.Host, opts.Port)
+	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 	log.Println("[main] starting...")
 	log.Println("[main] running on", addr, "...")
 
-	log.Fatal(http.ListenAndServe(addr, app))
+	return http.ListenAndServe(addr, app)
+}
+
+func init() {
+	parser.AddCommand("serve", "Run the server", "Run the reverse proxy and the management API (default when no command is given).", &serveCommand{})
+}
+
+func main() {
+	args := os.Args[1:]
+	if !hasCommand(args) {
+		args = append([]string{"serve"}, args...)
+	}
+
+	if _, err := parser.ParseArgs(args); err != nil {
+		if e, ok := err.(*flags.Error); ok {
+			if e.Type == flags.ErrHelp {
+				return
+			}
+			parser.WriteHelp(os.Stderr)
+		}
+		os.Exit(1)
+	}
+}
+
+// hasCommand reports whether args name a command. Without one the server
+// runs, as it did before there were commands.
+func hasCommand(args []string) bool {
+	for _, v := range args {
+		if v == "--" {
+			return false
+		}
+		if v == "-h" || v == "--help" || parser.Find(v) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func newClient() (*client.Client, error) {
+	if global.Server == "" {
+		return nil, fmt.Errorf("--server or PHANTASMA_SERVER is required")
+	}
+	return client.New(global.Server, client.WithToken(global.Token))
+}
+
+// signalContext is canceled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// output prints v as JSON, or as a table written by table.
+func output(v interface{}, table func(w *tabwriter.Writer)) error {
+	if global.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
 }
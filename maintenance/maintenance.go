@@ -0,0 +1,155 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mix3/phantasma/options"
+)
+
+type Entry struct {
+	Message    string    `json:"message"`
+	RetryAfter int       `json:"retry_after"`
+	Since      time.Time `json:"since"`
+}
+
+type State struct {
+	Global     *Entry           `json:"global"`
+	Subdomains map[string]Entry `json:"subdomains"`
+}
+
+// Store keeps the maintenance state and saves it to
+// <state-dir>/maintenance.json on every change.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	state State
+}
+
+func New(opts options.Options) (*Store, error) {
+	s := &Store{
+		path: filepath.Join(opts.StateDir, "maintenance.json"),
+		state: State{
+			Subdomains: make(map[string]Entry),
+		},
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.state); err != nil {
+		return nil, fmt.Errorf("could not load %s: %v", s.path, err)
+	}
+	if s.state.Subdomains == nil {
+		s.state.Subdomains = make(map[string]Entry)
+	}
+
+	if s.state.Global != nil {
+		log.Println("[maintenance] restore global")
+	}
+	for k, _ := range s.state.Subdomains {
+		log.Println("[maintenance] restore", k)
+	}
+
+	return s, nil
+}
+
+// Set puts subdomain into maintenance, or every subdomain when it is empty.
+func (s *Store) Set(subdomain string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("[maintenance] enable %q", subdomain)
+
+	entry.Since = time.Now()
+	if subdomain == "" {
+		s.state.Global = &entry
+	} else {
+		s.state.Subdomains[subdomain] = entry
+	}
+
+	return s.save()
+}
+
+func (s *Store) Del(subdomain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("[maintenance] disable %q", subdomain)
+
+	if subdomain == "" {
+		if s.state.Global == nil {
+			return fmt.Errorf("global maintenance not enabled")
+		}
+		s.state.Global = nil
+	} else {
+		if _, ok := s.state.Subdomains[subdomain]; !ok {
+			return fmt.Errorf("maintenance not enabled: %s", subdomain)
+		}
+		delete(s.state.Subdomains, subdomain)
+	}
+
+	return s.save()
+}
+
+// Get returns the maintenance entry in effect for subdomain. A nested
+// hostname such as "api.<subdomain>" follows <subdomain>.
+func (s *Store) Get(subdomain string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.state.Subdomains[subdomain]; ok {
+		return e, true
+	}
+	if i := strings.Index(subdomain, "."); 0 <= i {
+		if e, ok := s.state.Subdomains[subdomain[i+1:]]; ok {
+			return e, true
+		}
+	}
+	if s.state.Global != nil {
+		return *s.state.Global, true
+	}
+	return Entry{}, false
+}
+
+func (s *Store) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := State{
+		Global:     s.state.Global,
+		Subdomains: make(map[string]Entry, len(s.state.Subdomains)),
+	}
+	for k, v := range s.state.Subdomains {
+		result.Subdomains[k] = v
+	}
+	return result
+}
+
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mix3/phantasma/accesslog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const namespace = "phantasma"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "requests_total",
+			Help:      "Number of proxied requests by subdomain (_unknown for hosts that are no environment) and status class.",
+		},
+		[]string{"subdomain", "code"},
+	)
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of proxied requests by subdomain.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"subdomain"},
+	)
+	upstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "upstream_errors_total",
+			Help:      "Number of failed upstream round trips by subdomain.",
+		},
+		[]string{"subdomain"},
+	)
+	websocketConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "proxy",
+			Name:      "websocket_connections",
+			Help:      "Number of active websocket connections by subdomain.",
+		},
+		[]string{"subdomain"},
+	)
+	rktCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "rkt",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of rkt api-service gRPC calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+	rktCallErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "rkt",
+			Name:      "call_errors_total",
+			Help:      "Number of failed rkt api-service gRPC calls by method.",
+		},
+		[]string{"method"},
+	)
+	dbusJobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "dbus",
+			Name:      "job_duration_seconds",
+			Help:      "Latency of systemd dbus jobs by operation.",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{"operation"},
+	)
+	dbusJobErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "dbus",
+			Name:      "job_errors_total",
+			Help:      "Number of failed systemd dbus jobs by operation.",
+		},
+		[]string{"operation"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		requestsTotal,
+		requestDuration,
+		upstreamErrors,
+		websocketConnections,
+		rktCallDuration,
+		rktCallErrors,
+		dbusJobDuration,
+		dbusJobErrors,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveRequest(e accesslog.Entry) {
+	if e.Subdomain == "" {
+		return
+	}
+	requestsTotal.WithLabelValues(e.Subdomain, fmt.Sprintf("%dxx", e.Status/100)).Inc()
+	requestDuration.WithLabelValues(e.Subdomain).Observe(e.Latency)
+}
+
+func UpstreamError(subdomain string) {
+	upstreamErrors.WithLabelValues(subdomain).Inc()
+}
+
+func WebsocketOpened(subdomain string) {
+	websocketConnections.WithLabelValues(subdomain).Inc()
+}
+
+func WebsocketClosed(subdomain string) {
+	websocketConnections.WithLabelValues(subdomain).Dec()
+}
+
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	rktCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		rktCallErrors.WithLabelValues(method).Inc()
+	}
+	return err
+}
+
+func ObserveDbusJob(operation string, start time.Time, err error) {
+	dbusJobDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dbusJobErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+type environmentsCollector struct {
+	desc  *prometheus.Desc
+	count func() (int, int, error)
+}
+
+func (c *environmentsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *environmentsCollector) Collect(ch chan<- prometheus.Metric) {
+	running, stopped, err := c.count()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(running), "running")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(stopped), "stopped")
+}
+
+func RegisterEnvironments(count func() (running, stopped int, err error)) error {
+	return prometheus.Register(&environmentsCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "environments"),
+			"Number of environments by state.",
+			[]string{"state"},
+			nil,
+		),
+		count: count,
+	})
+}
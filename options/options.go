@@ -1,16 +1,58 @@
 package options
 
+import "time"
+
 type Options struct {
-	Host            string `short:"h" long:"host" default:"127.0.0.1" description:"server host"`
-	Port            int    `short:"p" long:"port" default:"5000" description:"server port"`
-	ApiEndpoint     string `long:"api-endpoint" default:"localhost:15441" description:"rkt api endpoint"`
-	DefaultPort     int    `long:"default-port" default:"5000" description:"reverse proxy default port"`
-	DefaultNet      string `long:"default-net" default:"default" description:"reverse proxy default net"`
-	Domain          string `long:"domain" required:"true" description:"reverse proxy domain"`
-	InsecureOptions string `long:"insecure-options" default:"image" description:"rkt option"`
-	TmpDir          string `long:"tmp-dir" default:"/tmp" description:"tmp dir"`
-	Specific        string `long:"specific" default:"phantasma" description:"specific for prefix, suffix"`
-	ServiceDir      string `long:"service-dir" default:"/etc/systemd/system" description:"systemd service dir"`
-	Rkt             string `long:"rkt" default:"/usr/local/bin/rkt" description:"rkt command path"`
-	StaticDir       string `long:"static-dir" default:"." description:"static file server dir"`
+	Host                          string        `short:"h" long:"host" default:"127.0.0.1" description:"server host"`
+	Port                          int           `short:"p" long:"port" default:"5000" description:"server port"`
+	ApiEndpoint                   string        `long:"api-endpoint" default:"localhost:15441" description:"rkt api endpoint"`
+	DefaultPort                   int           `long:"default-port" default:"5000" description:"reverse proxy default port (used when the image declares no port)"`
+	DefaultNet                    string        `long:"default-net" default:"default" description:"reverse proxy default net"`
+	Domain                        string        `long:"domain" required:"true" description:"reverse proxy domain"`
+	InsecureOptions               string        `long:"insecure-options" default:"image" description:"rkt option"`
+	TmpDir                        string        `long:"tmp-dir" default:"/tmp" description:"tmp dir"`
+	Specific                      string        `long:"specific" default:"phantasma" description:"specific for prefix, suffix"`
+	ServiceDir                    string        `long:"service-dir" default:"/etc/systemd/system" description:"systemd service dir"`
+	Rkt                           string        `long:"rkt" default:"/usr/local/bin/rkt" description:"rkt command path"`
+	Docker2aci                    string        `long:"docker2aci" default:"/usr/local/bin/docker2aci" description:"docker2aci command path, converting uploaded docker archives (empty rejects them)"`
+	StateDir                      string        `long:"state-dir" default:"/var/lib/phantasma" description:"dir for state kept across restarts"`
+	StaticDir                     string        `long:"static-dir" default:"." description:"static file server dir"`
+	PathRouting                   bool          `long:"path-routing" description:"also route <path-prefix><subdomain>/ on --domain and on hosts outside of it to pods (no wildcard DNS needed)"`
+	PathPrefix                    string        `long:"path-prefix" default:"/_/" description:"path prefix for path routing"`
+	TCPHost                       string        `long:"tcp-host" default:"" description:"tcp forwarding listen host (defaults to --host)"`
+	TCPPortRange                  string        `long:"tcp-port-range" default:"" description:"tcp forwarding host port pool, e.g. 20000-20099 (empty disables)"`
+	MirrorMaxBody                 int           `long:"mirror-max-body" default:"1048576" description:"default max request body size mirrored (bytes)"`
+	CaptureSize                   int           `long:"capture-size" default:"50" description:"default number of requests captured per subdomain"`
+	CaptureMaxBody                int           `long:"capture-max-body" default:"65536" description:"default max body size captured (bytes)"`
+	RateLimit                     float64       `long:"rate-limit" default:"0" description:"default requests per second per subdomain (0 disables)"`
+	RateBurst                     int           `long:"rate-burst" default:"0" description:"default burst per subdomain"`
+	IPRateLimit                   float64       `long:"ip-rate-limit" default:"0" description:"default requests per second per client IP and subdomain (0 disables)"`
+	IPRateBurst                   int           `long:"ip-rate-burst" default:"0" description:"default burst per client IP and subdomain"`
+	MaxConns                      int           `long:"max-conns" default:"0" description:"default max concurrent upstream connections per subdomain (0 disables)"`
+	UpstreamDialTimeout           time.Duration `long:"upstream-dial-timeout" default:"10s" description:"timeout for connecting to pods"`
+	UpstreamResponseHeaderTimeout time.Duration `long:"upstream-response-header-timeout" default:"60s" description:"timeout for waiting for pod response headers (0 disables)"`
+	UpstreamIdleTimeout           time.Duration `long:"upstream-idle-timeout" default:"90s" description:"how long idle keep-alive connections to pods are kept"`
+	UpstreamMaxIdleConns          int           `long:"upstream-max-idle-conns" default:"100" description:"max idle keep-alive connections to pods in total"`
+	UpstreamMaxIdleConnsPerHost   int           `long:"upstream-max-idle-conns-per-host" default:"16" description:"max idle keep-alive connections per pod"`
+	UpstreamRetries               int           `long:"upstream-retries" default:"2" description:"retries of idempotent requests when a pod refuses the connection"`
+	CompressTypes                 string        `long:"compress-types" default:"text/*,application/javascript,application/json,application/xml,image/svg+xml" description:"content types compressed when compression is enabled"`
+	CompressMinSize               int           `long:"compress-min-size" default:"1024" description:"min response size compressed (bytes)"`
+	CacheDir                      string        `long:"cache-dir" default:"" description:"dir for disk caches (empty allows memory caches only)"`
+	CacheSize                     int           `long:"cache-size" default:"67108864" description:"default max cache size per subdomain (bytes)"`
+	CacheMaxEntry                 int           `long:"cache-max-entry" default:"1048576" description:"default max cached response size (bytes)"`
+	RktApiTimeout                 time.Duration `long:"rkt-api-timeout" default:"10s" description:"deadline for each rkt api call (0 disables)"`
+	RktApiMaxBackoff              time.Duration `long:"rkt-api-max-backoff" default:"30s" description:"max delay between reconnects to the rkt api"`
+	StartupTimeout                time.Duration `long:"startup-timeout" default:"5m" description:"how long to wait for the rkt api at startup (0 waits forever)"`
+	HealthInterval                time.Duration `long:"health-interval" default:"15s" description:"interval of systemd connection checks"`
+	DbusTimeout                   time.Duration `long:"dbus-timeout" default:"2m" description:"deadline for each systemd job such as starting a pod (0 disables)"`
+	LaunchTimeout                 time.Duration `long:"launch-timeout" default:"5m" description:"how long launch jobs wait for pods to run"`
+	PodCacheTTL                   time.Duration `long:"pod-cache-ttl" default:"5s" description:"how long the list of running pods is reused; launches, terminations and pods done starting drop it earlier (0 lists on every call)"`
+	RktApiConcurrency             int           `long:"rkt-api-concurrency" default:"8" description:"max concurrent InspectPod calls"`
+	FetchTimeout                  time.Duration `long:"fetch-timeout" default:"30m" description:"how long image fetch jobs may run"`
+	UploadMaxSize                 int64         `long:"upload-max-size" default:"4294967296" description:"max size of uploaded image archives (bytes)"`
+	JobHistory                    int           `long:"job-history" default:"100" description:"number of finished jobs kept"`
+	AccessLog                     string        `long:"access-log" default:"" description:"access log file (- for stdout)"`
+	AccessLogFormat               string        `long:"access-log-format" default:"json" description:"access log format (json, combined)"`
+	AccessLogDir                  string        `long:"access-log-dir" default:"" description:"per-subdomain access log dir"`
+	AccessLogRecent               int           `long:"access-log-recent" default:"100" description:"number of recent requests kept per subdomain"`
 }
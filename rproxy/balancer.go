@@ -0,0 +1,88 @@
+package rproxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/forms"
+)
+
+const downDuration = 10 * time.Second
+
+func (b *backend) healthy() []apis.ReplicaInfo {
+	now := time.Now()
+
+	result := []apis.ReplicaInfo{}
+	for _, v := range b.info.Replicas {
+		if until, ok := b.down[v.Host]; ok && now.Before(until) {
+			continue
+		}
+		result = append(result, v)
+	}
+
+	if len(result) == 0 {
+		return b.info.Replicas
+	}
+	return result
+}
+
+// pick chooses the replica serving r. The second result reports whether a
+// sticky cookie pointing to the chosen replica has to be issued.
+func (b *backend) pick(r *http.Request, cookieName string) (apis.ReplicaInfo, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replicas := b.healthy()
+
+	switch b.info.LB {
+	case forms.LBSticky:
+		if c, err := r.Cookie(cookieName); err == nil {
+			for _, v := range replicas {
+				if strconv.Itoa(v.Replica) == c.Value {
+					return v, false
+				}
+			}
+		}
+		return b.roundRobin(replicas), true
+
+	case forms.LBLeastConn:
+		result := replicas[0]
+		for _, v := range replicas[1:] {
+			if b.conns[v.Host] < b.conns[result.Host] {
+				result = v
+			}
+		}
+		return result, false
+
+	default:
+		return b.roundRobin(replicas), false
+	}
+}
+
+func (b *backend) roundRobin(replicas []apis.ReplicaInfo) apis.ReplicaInfo {
+	b.next++
+	return replicas[b.next%len(replicas)]
+}
+
+func (b *backend) acquire(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.conns[host]++
+}
+
+func (b *backend) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.conns[host]--
+}
+
+func (b *backend) markDown(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.down[host] = time.Now().Add(downDuration)
+}
@@ -0,0 +1,85 @@
+package rproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/mix3/phantasma/httpcache"
+)
+
+func (rp *ReverseProxy) SetCache(subdomain string, config httpcache.Config) error {
+	if config.Disk && rp.opts.CacheDir == "" {
+		return fmt.Errorf("disk cache requires --cache-dir")
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if c, ok := rp.caches[subdomain]; ok {
+		if c.Config() == config {
+			return nil
+		}
+		c.Purge()
+	}
+
+	c, err := httpcache.New(config, rp.opts.CacheDir, cacheDirName(subdomain))
+	if err != nil {
+		return err
+	}
+
+	log.Println("[proxy] cache", subdomain, config)
+
+	rp.caches[subdomain] = c
+
+	return nil
+}
+
+// cacheDirName names the disk cache of subdomain under --cache-dir.
+func cacheDirName(subdomain string) string {
+	sum := sha256.Sum256([]byte(subdomain))
+	return hex.EncodeToString(sum[:])
+}
+
+func (rp *ReverseProxy) DelCache(subdomain string) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	c, ok := rp.caches[subdomain]
+	if !ok {
+		return fmt.Errorf("cache not enabled: %s", subdomain)
+	}
+
+	log.Println("[proxy] uncache", subdomain)
+
+	delete(rp.caches, subdomain)
+
+	return c.Purge()
+}
+
+func (rp *ReverseProxy) PurgeCache(subdomain string) error {
+	c, ok := rp.getCache(subdomain)
+	if !ok {
+		return fmt.Errorf("cache not enabled: %s", subdomain)
+	}
+
+	log.Println("[proxy] purge cache", subdomain)
+
+	return c.Purge()
+}
+
+func (rp *ReverseProxy) getCache(subdomain string) (*httpcache.Cache, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	c, ok := rp.caches[subdomain]
+	return c, ok
+}
+
+// cacheKey identifies a response of target, the subdomain actually serving
+// r. Mounted requests include the prefix since responses are rewritten for it.
+func cacheKey(r *http.Request, target string) string {
+	return target + " " + r.Host + " " + r.Header.Get("X-Forwarded-Prefix") + " " + r.URL.RequestURI()
+}
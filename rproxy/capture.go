@@ -0,0 +1,103 @@
+package rproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mix3/phantasma/capture"
+)
+
+const (
+	replayHeader  = "X-Phantasma-Replay"
+	replayTimeout = 60 * time.Second
+	replayMaxBody = 1 << 20
+)
+
+type ReplayResult struct {
+	Subdomain     string      `json:"subdomain"`
+	Status        int         `json:"status"`
+	Header        http.Header `json:"header"`
+	Body          string      `json:"body"`
+	BodyTruncated bool        `json:"body_truncated"`
+}
+
+func (rp *ReverseProxy) Captures() *capture.Store {
+	return rp.captures
+}
+
+// Replay re-sends a captured request to target and returns its response.
+func (rp *ReverseProxy) Replay(c *capture.Capture, target string) (ReplayResult, error) {
+	if c.RequestBodyTruncated {
+		return ReplayResult{}, fmt.Errorf("cannot replay truncated request body: %s", c.Id)
+	}
+
+	req, err := http.NewRequest(c.Method, c.Path, bytes.NewReader(c.RequestBody))
+	if err != nil {
+		return ReplayResult{}, err
+	}
+	req.Header = cloneHeader(c.RequestHeader)
+	// Redacted credentials are left out rather than sent as they are.
+	for k, v := range req.Header {
+		if len(v) == 1 && v[0] == capture.Redacted {
+			req.Header.Del(k)
+		}
+	}
+	req.Header.Set(replayHeader, c.Id)
+	req.Host = target + "." + rp.opts.Domain
+	req.RemoteAddr = "127.0.0.1:0"
+	if len(c.RequestBody) == 0 {
+		req.Body = http.NoBody
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+
+	rec := newRecorder()
+	rp.ServeHTTPWithSubdomain(rec, req.WithContext(ctx), target)
+
+	return ReplayResult{
+		Subdomain:     target,
+		Status:        rec.status,
+		Header:        rec.header,
+		Body:          rec.body.String(),
+		BodyTruncated: rec.truncated,
+	}, nil
+}
+
+// recorder keeps the first replayMaxBody bytes of the replayed response.
+type recorder struct {
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rest := replayMaxBody - rec.body.Len()
+	if rest < len(b) {
+		rec.truncated = true
+		if 0 < rest {
+			rec.body.Write(b[:rest])
+		}
+		return len(b), nil
+	}
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	rec.status = status
+}
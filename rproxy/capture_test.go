@@ -0,0 +1,19 @@
+package rproxy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecorderTruncates(t *testing.T) {
+	rec := newRecorder()
+	chunk := bytes.Repeat([]byte("x"), replayMaxBody/2+1)
+	for i := 0; i < 3; i++ {
+		if n, err := rec.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("write %d, %v", n, err)
+		}
+	}
+	if rec.body.Len() != replayMaxBody || !rec.truncated {
+		t.Errorf("body %d bytes, truncated %v", rec.body.Len(), rec.truncated)
+	}
+}
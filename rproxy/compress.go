@@ -0,0 +1,189 @@
+package rproxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+func (rp *ReverseProxy) SetCompress(subdomain string, enable bool) {
+	log.Println("[proxy] compress", subdomain, enable)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if enable {
+		rp.compress[subdomain] = true
+	} else {
+		delete(rp.compress, subdomain)
+	}
+}
+
+func (rp *ReverseProxy) getCompress(subdomain string) bool {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	return rp.compress[subdomain]
+}
+
+// compressWriter wraps w so that the response is encoded for the client
+// when compression is enabled for subdomain. finish must be called once the
+// response is complete.
+func (rp *ReverseProxy) compressWriter(w http.ResponseWriter, r *http.Request, subdomain string) (http.ResponseWriter, func()) {
+	if !rp.getCompress(subdomain) || r.Method == "HEAD" || isWebsocket(r) {
+		return w, func() {}
+	}
+
+	encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return w, func() {}
+	}
+
+	cw := &compressResponseWriter{
+		ResponseWriter: w,
+		encoding:       encoding,
+		types:          strings.Split(rp.opts.CompressTypes, ","),
+		minSize:        rp.opts.CompressMinSize,
+	}
+	return cw, cw.finish
+}
+
+// acceptEncoding picks br or gzip from an Accept-Encoding header, preferring
+// br when both are equally acceptable.
+func acceptEncoding(header string) string {
+	q := map[string]float64{}
+	for _, v := range strings.Split(header, ",") {
+		kv := strings.Split(strings.TrimSpace(v), ";")
+		name := strings.ToLower(strings.TrimSpace(kv[0]))
+		weight := 1.0
+		for _, p := range kv[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				weight, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		q[name] = weight
+	}
+
+	result, best := "", 0.0
+	for _, v := range []string{"br", "gzip"} {
+		weight, ok := q[v]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && best < weight {
+			result, best = v, weight
+		}
+	}
+	return result
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	types       []string
+	minSize     int
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+func (cw *compressResponseWriter) compressible(status int) bool {
+	h := cw.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if v := h.Get("Content-Length"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n < cw.minSize {
+			return false
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, v := range cw.types {
+		if ok, _ := path.Match(strings.TrimSpace(v), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	h.Add("Vary", "Accept-Encoding")
+
+	if cw.compressible(status) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch cw.encoding {
+		case "br":
+			cw.encoder = brotli.NewWriter(cw.ResponseWriter)
+		default:
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressResponseWriter) Flush() {
+	if f, ok := cw.encoder.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+func (cw *compressResponseWriter) finish() {
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
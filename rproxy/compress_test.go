@@ -0,0 +1,61 @@
+package rproxy
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mix3/phantasma/httpcache"
+	"github.com/mix3/phantasma/options"
+)
+
+func TestCompressedCacheHit(t *testing.T) {
+	rp := &ReverseProxy{
+		compress: map[string]bool{"app": true},
+		opts:     options.Options{CompressTypes: "text/*"},
+	}
+	cache, err := httpcache.New(httpcache.Config{MaxSize: 1 << 20, MaxEntry: 1 << 20}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat("hello ", 100)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(body))
+	})
+
+	for i, want := range []string{"MISS", "HIT"} {
+		r := httptest.NewRequest("GET", "http://app.example.com/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		cw, finish := rp.compressWriter(w, r, "app")
+		cache.Serve(cw, r, "app/", upstream)
+		finish()
+
+		res := w.Result()
+		if got := res.Header.Get("X-Phantasma-Cache"); got != want {
+			t.Errorf("request %d: cache %q, want %q", i, got, want)
+		}
+		if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("request %d: Content-Encoding %q, want gzip", i, got)
+		}
+
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if string(b) != body {
+			t.Errorf("request %d: body %q", i, b)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package rproxy
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mix3/phantasma/forms"
+)
+
+const ipBucketIdle = time.Minute
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take consumes a token, or reports how long to wait until one is available.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if 1 <= b.tokens {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type limiter struct {
+	limits    forms.Limits
+	mu        sync.Mutex
+	bucket    *bucket
+	ipBuckets map[string]*bucket
+	lastSweep time.Time
+	conns     int
+}
+
+func burstFor(rate float64, burst int) int {
+	if 0 < burst {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(rate)))
+}
+
+// newLimiter applies the defaults to the zero limits of an environment. Limits
+// set to forms.NoLimit stay off.
+func (rp *ReverseProxy) newLimiter(limits forms.Limits) *limiter {
+	if limits.Rate == 0 {
+		limits.Rate = rp.opts.RateLimit
+	}
+	if limits.Burst == 0 {
+		limits.Burst = rp.opts.RateBurst
+	}
+	if limits.IPRate == 0 {
+		limits.IPRate = rp.opts.IPRateLimit
+	}
+	if limits.IPBurst == 0 {
+		limits.IPBurst = rp.opts.IPRateBurst
+	}
+	if limits.MaxConns == 0 {
+		limits.MaxConns = rp.opts.MaxConns
+	}
+
+	now := time.Now()
+	l := &limiter{
+		limits:    limits,
+		ipBuckets: make(map[string]*bucket),
+		lastSweep: now,
+	}
+	if 0 < limits.Rate {
+		l.bucket = newBucket(limits.Rate, burstFor(limits.Rate, limits.Burst), now)
+	}
+
+	return l
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquire admits r, or returns the Retry-After duration when a limit is hit.
+// Admitted requests must call release when done.
+func (l *limiter) acquire(r *http.Request) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if 0 < l.limits.MaxConns && l.limits.MaxConns <= l.conns {
+		return false, time.Second
+	}
+
+	if 0 < l.limits.IPRate {
+		l.sweep(now)
+
+		ip := clientIP(r)
+		b, ok := l.ipBuckets[ip]
+		if !ok {
+			b = newBucket(l.limits.IPRate, burstFor(l.limits.IPRate, l.limits.IPBurst), now)
+			l.ipBuckets[ip] = b
+		}
+		if ok, wait := b.take(now); !ok {
+			return false, wait
+		}
+	}
+
+	if l.bucket != nil {
+		if ok, wait := l.bucket.take(now); !ok {
+			return false, wait
+		}
+	}
+
+	l.conns++
+
+	return true, 0
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns--
+}
+
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < ipBucketIdle {
+		return
+	}
+	for ip, b := range l.ipBuckets {
+		if ipBucketIdle < now.Sub(b.last) {
+			delete(l.ipBuckets, ip)
+		}
+	}
+	l.lastSweep = now
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
@@ -0,0 +1,32 @@
+package rproxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/options"
+)
+
+func TestNewLimiterDefaults(t *testing.T) {
+	rp := &ReverseProxy{opts: options.Options{RateLimit: 1, RateBurst: 1, MaxConns: 1}}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// Zero limits take the defaults.
+	l := rp.newLimiter(forms.Limits{})
+	if ok, _ := l.acquire(r); !ok {
+		t.Fatal("first request not admitted")
+	}
+	l.release()
+	if ok, _ := l.acquire(r); ok {
+		t.Error("default rate limit not applied")
+	}
+
+	// NoLimit turns them off.
+	l = rp.newLimiter(forms.Limits{Rate: forms.NoLimit, MaxConns: forms.NoLimit})
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.acquire(r); !ok {
+			t.Fatalf("request %d not admitted", i)
+		}
+	}
+}
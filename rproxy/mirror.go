@@ -0,0 +1,186 @@
+package rproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mix3/phantasma/forms"
+)
+
+const (
+	mirrorHeader      = "X-Phantasma-Mirror"
+	mirrorTimeout     = 30 * time.Second
+	mirrorConcurrency = 64
+)
+
+func (rp *ReverseProxy) SetMirror(subdomain string, mirror forms.Mirror) {
+	log.Println("[proxy] mirror", subdomain, "->", mirror.Target)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.mirrors[subdomain] = mirror
+}
+
+func (rp *ReverseProxy) DelMirror(subdomain string) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if _, ok := rp.mirrors[subdomain]; !ok {
+		return fmt.Errorf("mirror not found: %s", subdomain)
+	}
+
+	log.Println("[proxy] unmirror", subdomain)
+
+	delete(rp.mirrors, subdomain)
+
+	return nil
+}
+
+func (rp *ReverseProxy) getMirror(subdomain string) (forms.Mirror, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	mirror, ok := rp.mirrors[subdomain]
+	return mirror, ok
+}
+
+// mirror samples r for the mirror target of subdomain and returns a func
+// that sends the copy in the background. r.Body is teed into a buffer of at
+// most max_body bytes as it is proxied, so the copy is sent once the primary
+// request is done, and dropped when the body was larger or not read through.
+func (rp *ReverseProxy) mirror(r *http.Request, subdomain string) func() {
+	m, ok := rp.getMirror(subdomain)
+	if !ok || r.Header.Get(mirrorHeader) != "" || isWebsocket(r) {
+		return func() {}
+	}
+
+	if m.Rate <= rand.Float64() {
+		return func() {}
+	}
+
+	var (
+		method     = r.Method
+		url        = r.URL.String()
+		header     = cloneHeader(r.Header)
+		remoteAddr = r.RemoteAddr
+		tee        *teeBody
+	)
+	if r.Body != nil && r.Body != http.NoBody {
+		tee = &teeBody{ReadCloser: r.Body, max: m.MaxBody}
+		r.Body = tee
+	}
+
+	return func() {
+		var body []byte
+		if tee != nil {
+			var ok bool
+			if body, ok = tee.bytes(); !ok {
+				return
+			}
+		}
+
+		select {
+		case rp.mirrorSem <- struct{}{}:
+		default:
+			log.Printf("[proxy] mirror %s -> %s dropped: too many in flight", subdomain, m.Target)
+			return
+		}
+
+		mr, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			<-rp.mirrorSem
+			return
+		}
+		mr.Header = header
+		mr.Header.Set(mirrorHeader, subdomain)
+		mr.Host = m.Target + "." + rp.opts.Domain
+		mr.RemoteAddr = remoteAddr
+		if body == nil {
+			mr.Body = http.NoBody
+			mr.ContentLength = 0
+		}
+
+		go func() {
+			defer func() { <-rp.mirrorSem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+			defer cancel()
+
+			rp.ServeHTTPWithSubdomain(newDiscardWriter(), mr.WithContext(ctx), m.Target)
+		}()
+	}
+}
+
+// teeBody keeps a copy of the first max bytes read from a request body. The
+// transport may still be reading it when the response is done.
+type teeBody struct {
+	io.ReadCloser
+	max int
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	eof       bool
+	truncated bool
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.buf.Len()+n <= t.max {
+		t.buf.Write(p[:n])
+	} else {
+		t.truncated = true
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	return n, err
+}
+
+// bytes returns the body when it was read through within max bytes.
+func (t *teeBody) bytes() ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.eof || t.truncated {
+		return nil, false
+	}
+	return t.buf.Bytes(), true
+}
+
+func cloneHeader(h http.Header) http.Header {
+	result := make(http.Header, len(h))
+	for k, v := range h {
+		result[k] = append([]string(nil), v...)
+	}
+	return result
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: make(http.Header)}
+}
+
+func (d *discardWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d *discardWriter) WriteHeader(int) {}
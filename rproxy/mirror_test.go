@@ -0,0 +1,44 @@
+package rproxy
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestTeeBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		max  int
+		read int64
+		ok   bool
+	}{
+		{"read through", "hello", 5, -1, true},
+		{"too large", "hello", 4, -1, false},
+		{"not read through", "hello", 5, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tee := &teeBody{ReadCloser: ioutil.NopCloser(strings.NewReader(tt.body)), max: tt.max}
+
+			var r io.Reader = tee
+			if 0 <= tt.read {
+				r = io.LimitReader(tee, tt.read)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.read < 0 && string(got) != tt.body {
+				t.Errorf("proxied %q, want %q", got, tt.body)
+			}
+
+			body, ok := tee.bytes()
+			if ok != tt.ok || ok && string(body) != tt.body {
+				t.Errorf("copy %q, %v", body, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package rproxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type mountKey struct{}
+
+type mount struct {
+	prefix    string
+	subdomain string
+}
+
+func (rp *ReverseProxy) ServeHTTPWithPrefix(w http.ResponseWriter, r *http.Request, subdomain, prefix string) {
+	if r.URL.Path == prefix {
+		u := *r.URL
+		u.Path = prefix + "/"
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return
+	}
+
+	r2 := r.WithContext(context.WithValue(r.Context(), mountKey{}, mount{
+		prefix:    prefix,
+		subdomain: subdomain,
+	}))
+	u := *r.URL
+	u.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	if r.URL.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	}
+	r2.URL = &u
+	// WithContext shares the header with r.
+	r2.Header = r.Header.Clone()
+	r2.Header.Set("X-Forwarded-Prefix", prefix)
+
+	rp.ServeHTTPWithSubdomain(w, r2, subdomain)
+}
+
+func (rp *ReverseProxy) rewriteResponse(upstream string) func(*http.Response) error {
+	return func(res *http.Response) error {
+		m, ok := res.Request.Context().Value(mountKey{}).(mount)
+		if !ok {
+			return nil
+		}
+
+		if loc := res.Header.Get("Location"); loc != "" {
+			res.Header.Set("Location", rp.rewriteLocation(loc, m, upstream))
+		}
+
+		if cookies := res.Header["Set-Cookie"]; 0 < len(cookies) {
+			rewritten := make([]string, 0, len(cookies))
+			for _, v := range cookies {
+				rewritten = append(rewritten, rewriteCookiePath(v, m.prefix))
+			}
+			res.Header["Set-Cookie"] = rewritten
+		}
+
+		return nil
+	}
+}
+
+func (rp *ReverseProxy) rewriteLocation(loc string, m mount, upstream string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+
+	switch {
+	case u.Host == "" && strings.HasPrefix(u.Path, "/"):
+	case u.Host == upstream, strings.Split(u.Host, ":")[0] == m.subdomain+"."+rp.opts.Domain:
+		u.Scheme = ""
+		u.Host = ""
+		u.User = nil
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	default:
+		return loc
+	}
+
+	u.Path = m.prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = m.prefix + u.RawPath
+	}
+
+	return u.String()
+}
+
+func rewriteCookiePath(cookie, prefix string) string {
+	attrs := strings.Split(cookie, ";")
+	found := false
+	for i, v := range attrs {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if !strings.EqualFold(kv[0], "path") {
+			continue
+		}
+		path := "/"
+		if len(kv) == 2 && strings.HasPrefix(kv[1], "/") {
+			path = kv[1]
+		}
+		attrs[i] = " Path=" + prefix + path
+		found = true
+	}
+	if !found {
+		attrs = append(attrs, " Path="+prefix+"/")
+	}
+	return strings.Join(attrs, ";")
+}
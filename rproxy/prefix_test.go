@@ -0,0 +1,49 @@
+package rproxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mix3/phantasma/errorpage"
+	"github.com/mix3/phantasma/maintenance"
+	"github.com/mix3/phantasma/options"
+)
+
+func TestServeHTTPWithPrefixKeepsRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := options.Options{StateDir: dir, StaticDir: dir}
+	store, err := maintenance.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("app", maintenance.Entry{RetryAfter: 1}); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := errorpage.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := &ReverseProxy{rpMap: make(map[string]*backend), maintenance: store, pages: pages, opts: opts}
+
+	r := httptest.NewRequest("GET", "/app/path", nil)
+	w := httptest.NewRecorder()
+	rp.ServeHTTPWithPrefix(w, r, "app", "/app")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d", w.Code)
+	}
+	if got := r.Header.Get("X-Forwarded-Prefix"); got != "" {
+		t.Errorf("X-Forwarded-Prefix %q set on the original request", got)
+	}
+	if r.URL.Path != "/app/path" {
+		t.Errorf("path changed to %q", r.URL.Path)
+	}
+}
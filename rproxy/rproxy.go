@@ -1,87 +1,418 @@
 package rproxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mix3/phantasma/accesslog"
 	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/capture"
+	"github.com/mix3/phantasma/errorpage"
 	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/httpcache"
+	"github.com/mix3/phantasma/maintenance"
+	"github.com/mix3/phantasma/metrics"
 	"github.com/mix3/phantasma/options"
 )
 
+var (
+	errStopped  = errors.New("container not running")
+	errStarting = errors.New("container starting")
+)
+
+type backend struct {
+	info    apis.PodInfo
+	mu      sync.Mutex
+	proxies map[string]*httputil.ReverseProxy
+	next    int
+	conns   map[string]int
+	down    map[string]time.Time
+	limiter *limiter
+}
+
 type ReverseProxy struct {
-	api   *apis.Api
-	rpMap map[string]*httputil.ReverseProxy
-	opts  options.Options
+	api      *apis.Api
+	mu       sync.Mutex
+	rpMap    map[string]*backend
+	inits    map[string]*backendInit
+	aliases  map[string]string
+	splits   map[string]forms.Variants
+	mirrors  map[string]forms.Mirror
+	compress map[string]bool
+	caches   map[string]*httpcache.Cache
+	opts     options.Options
+
+	captures    *capture.Store
+	maintenance *maintenance.Store
+	mirrorSem   chan struct{}
+	pages       *errorpage.Pages
+	transport   *retryTransport
 }
 
 func New(api *apis.Api, opts options.Options) (*ReverseProxy, error) {
-	podInfoMap, err := api.PodInfoMap()
+	ctx := context.Background()
+	if 0 < opts.StartupTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.StartupTimeout)
+		defer cancel()
+	}
+	if err := api.WaitReady(ctx); err != nil {
+		return nil, err
+	}
+
+	podInfoMap, err := api.PodInfoMap(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	rpMap := make(map[string]*httputil.ReverseProxy)
-	for k, _ := range podInfoMap {
+	pages, err := errorpage.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	maintenanceStore, err := maintenance.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rpMap := make(map[string]*backend)
+	aliases := make(map[string]string)
+	for k, v := range podInfoMap {
 		rpMap[k] = nil
+		for _, alias := range v.Aliases {
+			aliases[strings.ToLower(alias)] = k
+		}
 	}
 
 	return &ReverseProxy{
-		api:   api,
-		rpMap: rpMap,
-		opts:  opts,
+		api:      api,
+		rpMap:    rpMap,
+		inits:    make(map[string]*backendInit),
+		aliases:  aliases,
+		splits:   make(map[string]forms.Variants),
+		mirrors:  make(map[string]forms.Mirror),
+		compress: make(map[string]bool),
+		caches:   make(map[string]*httpcache.Cache),
+		opts:     opts,
+
+		captures:    capture.New(),
+		maintenance: maintenanceStore,
+		mirrorSem:   make(chan struct{}, mirrorConcurrency),
+		pages:       pages,
+		transport:   newTransport(opts),
 	}, nil
 }
 
-func (rp *ReverseProxy) newReverseProxy(subdomain string) (*httputil.ReverseProxy, error) {
-	podInfo, err := rp.api.GetPodInfo(subdomain)
+func (rp *ReverseProxy) newBackend(ctx context.Context, subdomain string) (*backend, error) {
+	podInfo, err := rp.api.GetPodInfo(ctx, subdomain)
 	if err != nil {
 		return nil, err
 	}
 
 	if !podInfo.Running {
-		return nil, fmt.Errorf("container not running: %s", subdomain)
+		starting, err := rp.api.Starting(ctx, subdomain)
+		if err != nil {
+			return nil, err
+		}
+		if starting {
+			return nil, errStarting
+		}
+
+		// Starting drops the cached pods when they just started.
+		podInfo, err = rp.api.GetPodInfo(ctx, subdomain)
+		if err != nil {
+			return nil, err
+		}
+		if !podInfo.Running {
+			return nil, errStopped
+		}
 	}
 
-	dest, err := url.Parse(fmt.Sprintf("http://%s:%d", podInfo.Host, podInfo.Port))
+	return &backend{
+		info:    podInfo,
+		proxies: make(map[string]*httputil.ReverseProxy),
+		conns:   make(map[string]int),
+		down:    make(map[string]time.Time),
+		limiter: rp.newLimiter(podInfo.Limits),
+	}, nil
+}
+
+func (rp *ReverseProxy) proxy(b *backend, subdomain string, replica apis.ReplicaInfo, port int) (*httputil.ReverseProxy, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	upstream := fmt.Sprintf("%s:%d", replica.Host, port)
+	if proxy, ok := b.proxies[upstream]; ok {
+		return proxy, nil
+	}
+
+	dest, err := url.Parse("http://" + upstream)
 	if err != nil {
 		return nil, err
 	}
 
-	return httputil.NewSingleHostReverseProxy(dest), nil
+	proxy := httputil.NewSingleHostReverseProxy(dest)
+	proxy.Transport = rp.transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, context.Canceled) {
+			log.Printf("[proxy] client canceled %s (%s)", subdomain, upstream)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		log.Printf("[proxy] upstream error %s (%s): %v", subdomain, upstream, err)
+		metrics.UpstreamError(subdomain)
+
+		status := upstreamStatus(err)
+		if status == http.StatusGatewayTimeout {
+			rp.pages.UpstreamError(w, r, subdomain, status, "The upstream server did not respond in time.")
+			return
+		}
+
+		b.markDown(replica.Host)
+		rp.pages.UpstreamError(w, r, subdomain, status, "The upstream server could not be reached.")
+	}
+	proxy.ModifyResponse = rp.rewriteResponse(upstream)
+
+	b.proxies[upstream] = proxy
+
+	return proxy, nil
+}
+
+func (rp *ReverseProxy) stickyCookie() string {
+	return rp.opts.Specific + "-replica"
+}
+
+// backendInit is a backend being initialized. Requests for the subdomain
+// wait for it instead of each asking rkt.
+type backendInit struct {
+	done chan struct{}
+	b    *backend
+	err  error
+}
+
+// getBackend returns the backend of subdomain, initializing it outside of
+// rp.mu so that a slow rkt api holds up only requests for that subdomain.
+func (rp *ReverseProxy) getBackend(ctx context.Context, subdomain string) (*backend, bool, error) {
+	rp.mu.Lock()
+	b, ok := rp.rpMap[subdomain]
+	if !ok || b != nil {
+		rp.mu.Unlock()
+		return b, ok, nil
+	}
+
+	in, running := rp.inits[subdomain]
+	if !running {
+		in = &backendInit{done: make(chan struct{})}
+		rp.inits[subdomain] = in
+	}
+	rp.mu.Unlock()
+
+	if !running {
+		go rp.initBackend(subdomain, in)
+	}
+
+	select {
+	case <-in.done:
+		return in.b, true, in.err
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+}
+
+// initBackend runs apart from the request that started it, so that the
+// requests waiting for it are not failed by its cancellation. The rkt api
+// calls are bounded by --rkt-api-timeout.
+func (rp *ReverseProxy) initBackend(subdomain string, in *backendInit) {
+	log.Println("[proxy] initialize", subdomain)
+
+	in.b, in.err = rp.newBackend(context.Background(), subdomain)
+
+	rp.mu.Lock()
+	// An Add or Del meanwhile drops in, and its result is not kept.
+	if rp.inits[subdomain] == in {
+		delete(rp.inits, subdomain)
+		if in.err == nil {
+			rp.rpMap[subdomain] = in.b
+		}
+	}
+	rp.mu.Unlock()
+
+	close(in.done)
+}
+
+// logSubdomain returns the environment that requests for subdomain are
+// logged under: subdomain itself, the environment of a nested hostname such
+// as "api.<subdomain>", or accesslog.Unknown. Hosts that are not environments
+// thus never add access logs or metric labels.
+func (rp *ReverseProxy) logSubdomain(subdomain string) string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if _, ok := rp.rpMap[subdomain]; ok {
+		return subdomain
+	}
+	if i := strings.Index(subdomain, "."); 0 <= i {
+		if _, ok := rp.rpMap[subdomain[i+1:]]; ok {
+			return subdomain[i+1:]
+		}
+	}
+	return accesslog.Unknown
+}
+
+// resolve maps a subdomain to its backend and port. A nested hostname such
+// as "api.<subdomain>" resolves to the "api" port mapping of <subdomain>.
+func (rp *ReverseProxy) resolve(ctx context.Context, subdomain string) (*backend, int, bool, error) {
+	b, ok, err := rp.getBackend(ctx, subdomain)
+	if ok {
+		if err != nil {
+			return nil, 0, true, err
+		}
+		return b, b.info.Port, true, nil
+	}
+
+	i := strings.Index(subdomain, ".")
+	if i < 0 {
+		return nil, 0, false, nil
+	}
+
+	b, ok, err = rp.getBackend(ctx, subdomain[i+1:])
+	if !ok || err != nil {
+		return nil, 0, ok, err
+	}
+
+	port, ok := b.info.Ports.Get(subdomain[:i])
+	if !ok {
+		return nil, 0, false, nil
+	}
+
+	return b, port, true, nil
 }
 
 func (rp *ReverseProxy) ServeHTTPWithSubdomain(w http.ResponseWriter, r *http.Request, subdomain string) {
-	reverseProxy, ok := rp.rpMap[subdomain]
+	accesslog.SetSubdomain(r, rp.logSubdomain(subdomain))
+
+	if e, ok := rp.maintenance.Get(subdomain); ok {
+		rp.pages.Maintenance(w, r, subdomain, e.Message, e.RetryAfter)
+		return
+	}
+
+	defer rp.mirror(r, subdomain)()
+
+	cw, finishCompress := rp.compressWriter(w, r, subdomain)
+	defer finishCompress()
+	w = cw
+
+	if !isWebsocket(r) {
+		cw, finish := rp.captures.Start(w, r, subdomain)
+		defer finish()
+		w = cw
+	}
+
+	target := rp.variant(w, r, subdomain)
+	b, port, ok, err := rp.resolve(r.Context(), target)
 
 	if !ok {
-		http.NotFound(w, r)
+		rp.pages.NotFound(w, r, subdomain)
 		return
 	}
 
-	if reverseProxy != nil {
-		reverseProxy.ServeHTTP(w, r)
+	switch {
+	case err == nil:
+	case err == errStopped:
+		rp.pages.Stopped(w, r, subdomain)
+		return
+	case err == errStarting:
+		rp.pages.Starting(w, r, subdomain)
+		return
+	case errors.Is(err, apis.ErrTimeout):
+		log.Printf("[proxy] initialize %s: %v", subdomain, err)
+		rp.pages.UpstreamError(w, r, subdomain, http.StatusGatewayTimeout, "The container runtime did not respond in time.")
+		return
+	default:
+		log.Printf("[proxy] initialize %s: %v", subdomain, err)
+		rp.pages.UpstreamError(w, r, subdomain, http.StatusInternalServerError, "The environment could not be looked up.")
 		return
 	}
 
-	log.Println("[proxy] initialize", subdomain)
+	if c, ok := rp.getCache(subdomain); ok && !isWebsocket(r) {
+		c.Serve(w, r, cacheKey(r, target), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rp.serveBackend(w, r, b, subdomain, port)
+		}))
+		return
+	}
+
+	rp.serveBackend(w, r, b, subdomain, port)
+}
 
-	new, err := rp.newReverseProxy(subdomain)
+func (rp *ReverseProxy) serveBackend(w http.ResponseWriter, r *http.Request, b *backend, subdomain string, port int) {
+	admitted, wait := b.limiter.acquire(r)
+	if !admitted {
+		tooManyRequests(w, wait)
+		return
+	}
+	defer b.limiter.release()
+
+	replica, sticky := b.pick(r, rp.stickyCookie())
+	if sticky {
+		http.SetCookie(w, &http.Cookie{
+			Name:     rp.stickyCookie(),
+			Value:    strconv.Itoa(replica.Replica),
+			Path:     "/",
+			HttpOnly: true,
+		})
+	}
+
+	proxy, err := rp.proxy(b, subdomain, replica, port)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("[proxy] proxy %s (%s): %v", subdomain, replica.Host, err)
+		rp.pages.UpstreamError(w, r, subdomain, http.StatusInternalServerError, "The upstream server could not be reached.")
 		return
 	}
 
-	rp.rpMap[subdomain] = new
+	accesslog.SetUpstream(r, replica.Uuid, fmt.Sprintf("%s:%d", replica.Host, port))
+
+	b.acquire(replica.Host)
+	defer b.release(replica.Host)
+
+	if isWebsocket(r) {
+		metrics.WebsocketOpened(subdomain)
+		defer metrics.WebsocketClosed(subdomain)
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+func (rp *ReverseProxy) Maintenance() *maintenance.Store {
+	return rp.maintenance
+}
+
+func (rp *ReverseProxy) Close() {
+	rp.transport.Close()
+}
+
+func (rp *ReverseProxy) NotFound(w http.ResponseWriter, r *http.Request, subdomain string) {
+	rp.pages.NotFound(w, r, subdomain)
+}
 
-	new.ServeHTTP(w, r)
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
 }
 
 func (rp *ReverseProxy) subdomainList() []string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
 	subdomains := make([]string, 0, len(rp.rpMap))
 	for k, _ := range rp.rpMap {
 		subdomains = append(subdomains, k)
@@ -90,8 +421,22 @@ func (rp *ReverseProxy) subdomainList() []string {
 	return subdomains
 }
 
-func (rp *ReverseProxy) List() ([]apis.PodInfo, error) {
-	podInfoMap, err := rp.api.PodInfoMap()
+func (rp *ReverseProxy) splitList() []string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	subdomains := make([]string, 0, len(rp.splits))
+	for k, _ := range rp.splits {
+		if _, ok := rp.rpMap[k]; !ok {
+			subdomains = append(subdomains, k)
+		}
+	}
+	sort.Strings(subdomains)
+	return subdomains
+}
+
+func (rp *ReverseProxy) List(ctx context.Context) ([]apis.PodInfo, error) {
+	podInfoMap, err := rp.api.PodInfoMap(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -101,25 +446,156 @@ func (rp *ReverseProxy) List() ([]apis.PodInfo, error) {
 		if v, ok := podInfoMap[subdomain]; ok {
 			result = append(result, v)
 		} else {
-			result = append(result, apis.PodInfo{
-				Subdomain: subdomain,
-				Running:   false,
-				Env:       []forms.Env{},
-			})
+			result = append(result, rp.stoppedPodInfo(subdomain))
+		}
+	}
+	for _, subdomain := range rp.splitList() {
+		info := rp.stoppedPodInfo(subdomain)
+		variants, _ := rp.getSplit(subdomain)
+		for _, v := range variants {
+			if _, ok := podInfoMap[v.Subdomain]; ok {
+				info.Running = true
+			}
+		}
+		result = append(result, info)
+	}
+
+	for i, v := range result {
+		if variants, ok := rp.getSplit(v.Subdomain); ok {
+			result[i].Variants = variants
+		}
+		if mirror, ok := rp.getMirror(v.Subdomain); ok {
+			result[i].Mirror = &mirror
+		}
+		result[i].Compress = rp.getCompress(v.Subdomain)
+		if c, ok := rp.getCache(v.Subdomain); ok {
+			stats := c.Stats()
+			result[i].Cache = &stats
 		}
 	}
 
 	return result, nil
 }
 
-func (rp *ReverseProxy) Add(subdomain string) {
-	log.Println("[proxy] add proxy", subdomain)
+func (rp *ReverseProxy) Get(ctx context.Context, subdomain string) (apis.PodInfo, bool, error) {
+	list, err := rp.List(ctx)
+	if err != nil {
+		return apis.PodInfo{}, false, err
+	}
+
+	for _, v := range list {
+		if v.Subdomain == subdomain {
+			return v, true, nil
+		}
+	}
+	return apis.PodInfo{}, false, nil
+}
+
+func (rp *ReverseProxy) stoppedPodInfo(subdomain string) apis.PodInfo {
+	return apis.PodInfo{
+		Subdomain:   subdomain,
+		Running:     false,
+		Env:         []forms.Env{},
+		Aliases:     rp.aliasList(subdomain),
+		Ports:       forms.PortMaps{},
+		TCPForwards: forms.TCPForwards{},
+		Replicas:    []apis.ReplicaInfo{},
+		Variants:    forms.Variants{},
+	}
+}
+
+func (rp *ReverseProxy) Count() (int, int, error) {
+	podInfoMap, err := rp.api.PodInfoMap(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	subdomains := rp.subdomainList()
+
+	running := 0
+	for _, v := range subdomains {
+		if _, ok := podInfoMap[v]; ok {
+			running++
+		}
+	}
+
+	return running, len(subdomains) - running, nil
+}
+
+func (rp *ReverseProxy) Lookup(host string) (string, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	subdomain, ok := rp.aliases[strings.ToLower(host)]
+	return subdomain, ok
+}
+
+func (rp *ReverseProxy) aliasList(subdomain string) []string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	result := []string{}
+	for k, v := range rp.aliases {
+		if v == subdomain {
+			result = append(result, k)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (rp *ReverseProxy) CheckAliases(subdomain string, aliases []string) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, v := range aliases {
+		alias := strings.ToLower(v)
+		if alias == rp.opts.Domain || strings.HasSuffix(alias, "."+rp.opts.Domain) {
+			return fmt.Errorf("alias conflicts with domain: %s", v)
+		}
+		if owner, ok := rp.aliases[alias]; ok && owner != subdomain {
+			return fmt.Errorf("alias already used by %s: %s", owner, v)
+		}
+		if seen[alias] {
+			return fmt.Errorf("alias duplicated: %s", v)
+		}
+		seen[alias] = true
+	}
+
+	return nil
+}
+
+func (rp *ReverseProxy) deleteAliases(subdomain string) {
+	for k, v := range rp.aliases {
+		if v == subdomain {
+			delete(rp.aliases, k)
+		}
+	}
+}
+
+func (rp *ReverseProxy) Add(subdomain string, aliases []string) {
+	log.Println("[proxy] add proxy", subdomain, aliases)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
 
 	rp.rpMap[subdomain] = nil
+	delete(rp.inits, subdomain)
+
+	rp.deleteAliases(subdomain)
+	for _, v := range aliases {
+		rp.aliases[strings.ToLower(v)] = subdomain
+	}
 }
 
 func (rp *ReverseProxy) Del(subdomain string) {
 	log.Println("[proxy] del proxy", subdomain)
 
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
 	delete(rp.rpMap, subdomain)
+	delete(rp.inits, subdomain)
+	rp.deleteAliases(subdomain)
 }
@@ -0,0 +1,29 @@
+package rproxy
+
+import (
+	"testing"
+
+	"github.com/mix3/phantasma/accesslog"
+)
+
+func TestLogSubdomain(t *testing.T) {
+	rp := &ReverseProxy{rpMap: map[string]*backend{"app": nil, "api.web": nil}}
+
+	tests := []struct {
+		subdomain string
+		want      string
+	}{
+		{"app", "app"},
+		{"api.app", "app"},
+		{"random.app", "app"},
+		{"api.web", "api.web"},
+		{"x.api.web", "api.web"},
+		{"other", accesslog.Unknown},
+		{"x.y.app", accesslog.Unknown},
+	}
+	for _, tt := range tests {
+		if got := rp.logSubdomain(tt.subdomain); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.subdomain, got, tt.want)
+		}
+	}
+}
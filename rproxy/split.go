@@ -0,0 +1,102 @@
+package rproxy
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+
+	"github.com/mix3/phantasma/forms"
+)
+
+const variantHeader = "X-Phantasma-Variant"
+
+func (rp *ReverseProxy) variantCookie() string {
+	return rp.opts.Specific + "-variant"
+}
+
+func (rp *ReverseProxy) SetSplit(subdomain string, variants forms.Variants) {
+	log.Println("[proxy] split", subdomain, variants)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.splits[subdomain] = variants
+}
+
+func (rp *ReverseProxy) DelSplit(subdomain string) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if _, ok := rp.splits[subdomain]; !ok {
+		return fmt.Errorf("split not found: %s", subdomain)
+	}
+
+	log.Println("[proxy] unsplit", subdomain)
+
+	delete(rp.splits, subdomain)
+
+	return nil
+}
+
+func (rp *ReverseProxy) getSplit(subdomain string) (forms.Variants, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	variants, ok := rp.splits[subdomain]
+	return variants, ok
+}
+
+// variant returns the subdomain actually serving r. Clients pin a variant
+// with the X-Phantasma-Variant header or the variant cookie; otherwise one
+// is drawn by weight and remembered in the cookie.
+func (rp *ReverseProxy) variant(w http.ResponseWriter, r *http.Request, subdomain string) string {
+	variants, ok := rp.getSplit(subdomain)
+	if !ok {
+		return subdomain
+	}
+
+	if v := r.Header.Get(variantHeader); v != "" && hasVariant(variants, v) {
+		return v
+	}
+
+	if c, err := r.Cookie(rp.variantCookie()); err == nil && hasVariant(variants, c.Value) {
+		return c.Value
+	}
+
+	v := pickVariant(variants)
+	http.SetCookie(w, &http.Cookie{
+		Name:     rp.variantCookie(),
+		Value:    v,
+		Path:     "/",
+		HttpOnly: true,
+	})
+
+	return v
+}
+
+func hasVariant(variants forms.Variants, subdomain string) bool {
+	for _, v := range variants {
+		if v.Subdomain == subdomain {
+			return true
+		}
+	}
+	return false
+}
+
+func pickVariant(variants forms.Variants) string {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v.Subdomain
+		}
+		n -= v.Weight
+	}
+
+	return variants[len(variants)-1].Subdomain
+}
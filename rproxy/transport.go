@@ -0,0 +1,88 @@
+package rproxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/mix3/phantasma/options"
+)
+
+const retryBackoff = 200 * time.Millisecond
+
+// retryTransport retries bodiless idempotent requests when the pod refuses
+// the connection, e.g. while a replica restarts.
+type retryTransport struct {
+	base    *http.Transport
+	retries int
+}
+
+func newTransport(opts options.Options) *retryTransport {
+	dialer := &net.Dialer{
+		Timeout:   opts.UpstreamDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &retryTransport{
+		base: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          opts.UpstreamMaxIdleConns,
+			MaxIdleConnsPerHost:   opts.UpstreamMaxIdleConnsPerHost,
+			IdleConnTimeout:       opts.UpstreamIdleTimeout,
+			ResponseHeaderTimeout: opts.UpstreamResponseHeaderTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		retries: opts.UpstreamRetries,
+	}
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for i := 0; ; i++ {
+		res, err := t.base.RoundTrip(r)
+		if err == nil || t.retries <= i || !retryable(r, err) {
+			return res, err
+		}
+
+		log.Printf("[proxy] retry %s %s (%d/%d): %v", r.Method, r.URL, i+1, t.retries, err)
+
+		select {
+		case <-time.After(retryBackoff * time.Duration(i+1)):
+		case <-r.Context().Done():
+			return nil, err
+		}
+	}
+}
+
+func (t *retryTransport) Close() {
+	t.base.CloseIdleConnections()
+}
+
+func retryable(r *http.Request, err error) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+	default:
+		return false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// upstreamStatus maps a proxy error to the status returned to the client.
+func upstreamStatus(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
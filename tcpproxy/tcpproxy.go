@@ -0,0 +1,348 @@
+package tcpproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mix3/phantasma/apis"
+	"github.com/mix3/phantasma/forms"
+	"github.com/mix3/phantasma/options"
+)
+
+type forward struct {
+	subdomain string
+	listener  net.Listener
+
+	mu      sync.Mutex
+	podPort int
+}
+
+func (f *forward) port() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.podPort
+}
+
+type TCPProxy struct {
+	api      *apis.Api
+	mu       sync.Mutex
+	min      int
+	max      int
+	host     string
+	forwards map[int]*forward
+}
+
+func parseRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+
+	minMax := strings.Split(s, "-")
+	if len(minMax) != 2 {
+		return 0, 0, fmt.Errorf("cannot parse tcp port range: %s", s)
+	}
+	min, err := strconv.Atoi(minMax[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse tcp port range: %s", s)
+	}
+	max, err := strconv.Atoi(minMax[1])
+	if err != nil || max < min {
+		return 0, 0, fmt.Errorf("cannot parse tcp port range: %s", s)
+	}
+
+	return min, max, nil
+}
+
+func New(api *apis.Api, opts options.Options) (*TCPProxy, error) {
+	min, max, err := parseRange(opts.TCPPortRange)
+	if err != nil {
+		return nil, err
+	}
+
+	host := opts.TCPHost
+	if host == "" {
+		host = opts.Host
+	}
+
+	tp := &TCPProxy{
+		api:      api,
+		min:      min,
+		max:      max,
+		host:     host,
+		forwards: make(map[int]*forward),
+	}
+
+	if tp.max == 0 {
+		return tp, nil
+	}
+
+	podInfoMap, err := api.PodInfoMap(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for subdomain, info := range podInfoMap {
+		res, err := tp.Reserve(subdomain, info.TCPForwards)
+		if err != nil {
+			log.Printf("[tcpproxy] cannot restore %s: %v", subdomain, err)
+			continue
+		}
+		res.Commit()
+	}
+
+	return tp, nil
+}
+
+func (tp *TCPProxy) inPool(port int) bool {
+	return tp.min <= port && port <= tp.max
+}
+
+func (tp *TCPProxy) freePort() (int, error) {
+	for port := tp.min; port <= tp.max; port++ {
+		if _, ok := tp.forwards[port]; !ok {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free tcp port in %d-%d", tp.min, tp.max)
+}
+
+// heldPort returns a host port the subdomain already forwards to podPort and
+// that is not taken yet, so that relaunches keep their host ports.
+func (tp *TCPProxy) heldPort(subdomain string, podPort int, taken map[int]int) int {
+	ports := []int{}
+	for port, f := range tp.forwards {
+		if _, ok := taken[port]; !ok && f.subdomain == subdomain && f.port() == podPort {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return 0
+	}
+	sort.Ints(ports)
+	return ports[0]
+}
+
+// Reservation is a set of forwards for a subdomain being launched. The
+// forwards the subdomain already holds stay until it is committed, so that a
+// failed relaunch leaves the running pods reachable.
+type Reservation struct {
+	Forwards forms.TCPForwards
+
+	tp        *TCPProxy
+	subdomain string
+	opened    []int
+	podPorts  map[int]int
+}
+
+// Reserve assigns host ports from the pool to the requested forwards and
+// starts listening on the ones the subdomain does not hold yet.
+func (tp *TCPProxy) Reserve(subdomain string, requested forms.TCPForwards) (*Reservation, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	res := &Reservation{
+		Forwards:  forms.TCPForwards{},
+		tp:        tp,
+		subdomain: subdomain,
+		podPorts:  make(map[int]int),
+	}
+
+	if len(requested) == 0 {
+		return res, nil
+	}
+
+	if tp.max == 0 {
+		return nil, fmt.Errorf("tcp forwarding is disabled")
+	}
+
+	for _, v := range requested {
+		hostPort := v.HostPort
+		if hostPort == 0 {
+			hostPort = tp.heldPort(subdomain, v.PodPort, res.podPorts)
+		}
+		if hostPort == 0 {
+			port, err := tp.freePort()
+			if err != nil {
+				res.abort()
+				return nil, err
+			}
+			hostPort = port
+		}
+
+		if !tp.inPool(hostPort) {
+			res.abort()
+			return nil, fmt.Errorf("tcp port out of range %d-%d: %d", tp.min, tp.max, hostPort)
+		}
+
+		if _, ok := res.podPorts[hostPort]; ok {
+			res.abort()
+			return nil, fmt.Errorf("tcp port requested twice: %d", hostPort)
+		}
+
+		f, ok := tp.forwards[hostPort]
+		switch {
+		case ok && f.subdomain != subdomain:
+			res.abort()
+			return nil, fmt.Errorf("tcp port already used by %s: %d", f.subdomain, hostPort)
+		case !ok:
+			l, err := net.Listen("tcp", net.JoinHostPort(tp.host, strconv.Itoa(hostPort)))
+			if err != nil {
+				res.abort()
+				return nil, err
+			}
+
+			f := &forward{
+				subdomain: subdomain,
+				podPort:   v.PodPort,
+				listener:  l,
+			}
+			tp.forwards[hostPort] = f
+			res.opened = append(res.opened, hostPort)
+			go tp.serve(f)
+
+			log.Printf("[tcpproxy] forward %s:%d -> %s:%d", tp.host, hostPort, subdomain, v.PodPort)
+		}
+
+		res.podPorts[hostPort] = v.PodPort
+		res.Forwards = append(res.Forwards, forms.TCPForward{
+			HostPort: hostPort,
+			PodPort:  v.PodPort,
+		})
+	}
+
+	return res, nil
+}
+
+// Commit makes the reserved forwards those of the subdomain, releasing the
+// ones it held but no longer requests.
+func (res *Reservation) Commit() {
+	tp := res.tp
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for port, f := range tp.forwards {
+		if f.subdomain != res.subdomain {
+			continue
+		}
+		podPort, ok := res.podPorts[port]
+		if !ok {
+			f.listener.Close()
+			delete(tp.forwards, port)
+			log.Printf("[tcpproxy] release %s:%d", tp.host, port)
+			continue
+		}
+		if f.podPort != podPort {
+			f.mu.Lock()
+			f.podPort = podPort
+			f.mu.Unlock()
+			log.Printf("[tcpproxy] forward %s:%d -> %s:%d", tp.host, port, res.subdomain, podPort)
+		}
+	}
+}
+
+// Abort closes the forwards opened by the reservation and keeps those the
+// subdomain held before.
+func (res *Reservation) Abort() {
+	res.tp.mu.Lock()
+	defer res.tp.mu.Unlock()
+
+	res.abort()
+}
+
+func (res *Reservation) abort() {
+	tp := res.tp
+	for _, port := range res.opened {
+		if f, ok := tp.forwards[port]; ok {
+			f.listener.Close()
+			delete(tp.forwards, port)
+			log.Printf("[tcpproxy] release %s:%d", tp.host, port)
+		}
+	}
+	res.opened = nil
+}
+
+func (tp *TCPProxy) release(subdomain string) {
+	for port, f := range tp.forwards {
+		if f.subdomain == subdomain {
+			f.listener.Close()
+			delete(tp.forwards, port)
+			log.Printf("[tcpproxy] release %s:%d", tp.host, port)
+		}
+	}
+}
+
+func (tp *TCPProxy) Release(subdomain string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.release(subdomain)
+}
+
+func (tp *TCPProxy) Close() {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for port, f := range tp.forwards {
+		f.listener.Close()
+		delete(tp.forwards, port)
+	}
+}
+
+func (tp *TCPProxy) serve(f *forward) {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go tp.handle(f, conn)
+	}
+}
+
+func (tp *TCPProxy) handle(f *forward, conn net.Conn) {
+	defer conn.Close()
+
+	podInfo, err := tp.api.GetPodInfo(context.Background(), f.subdomain)
+	if err != nil {
+		log.Printf("[tcpproxy] %s: %v", f.subdomain, err)
+		return
+	}
+	if !podInfo.Running {
+		log.Printf("[tcpproxy] container not running: %s", f.subdomain)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", net.JoinHostPort(podInfo.Host, strconv.Itoa(f.port())))
+	if err != nil {
+		log.Printf("[tcpproxy] %s: %v", f.subdomain, err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		closeWrite(conn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(*net.TCPConn); ok {
+		c.CloseWrite()
+	}
+}
@@ -0,0 +1,85 @@
+package tcpproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mix3/phantasma/forms"
+)
+
+func newTestProxy(t *testing.T) *TCPProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	tp := &TCPProxy{
+		min:      port,
+		max:      port,
+		host:     "127.0.0.1",
+		forwards: make(map[int]*forward),
+	}
+	t.Cleanup(tp.Close)
+	return tp
+}
+
+func TestReservation(t *testing.T) {
+	tp := newTestProxy(t)
+
+	res, err := tp.Reserve("app", forms.TCPForwards{{PodPort: 5432}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Commit()
+	hostPort := res.Forwards[0].HostPort
+
+	// A relaunch keeps the host port, and the forward outlives an aborted
+	// one.
+	res, err = tp.Reserve("app", forms.TCPForwards{{PodPort: 5432}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Forwards[0].HostPort; got != hostPort {
+		t.Errorf("host port %d, want %d", got, hostPort)
+	}
+	res.Abort()
+	if f, ok := tp.forwards[hostPort]; !ok || f.subdomain != "app" {
+		t.Fatalf("forward of app released by abort")
+	}
+
+	if _, err := tp.Reserve("other", forms.TCPForwards{{HostPort: hostPort, PodPort: 80}}); err == nil {
+		t.Errorf("port of app reserved for other")
+	}
+
+	// A committed relaunch without forwards releases them.
+	res, err = tp.Reserve("app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Commit()
+	if _, ok := tp.forwards[hostPort]; ok {
+		t.Errorf("forward kept after commit")
+	}
+}
+
+func TestReservationAbortNew(t *testing.T) {
+	tp := newTestProxy(t)
+
+	res, err := tp.Reserve("app", forms.TCPForwards{{PodPort: 6379}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Abort()
+	if len(tp.forwards) != 0 {
+		t.Errorf("forwards %v after abort", tp.forwards)
+	}
+
+	// The port is free again.
+	res, err = tp.Reserve("other", forms.TCPForwards{{PodPort: 6379}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Commit()
+}